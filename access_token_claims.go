@@ -20,6 +20,12 @@ type AccessTokenClaims struct {
 
 	// expiration time after which the access_token is considered to be expired
 	Exp int64 `json:"exp"`
+	// the time at which the access_token was issued
+	Iat int64 `json:"iat,omitempty"`
+	// the time before which the access_token must not be accepted
+	Nbf int64 `json:"nbf,omitempty"`
+	// the unique identifier of the access_token to revoke it
+	Jti string `json:"jti,omitempty"`
 
 	// PLMN ID of the NF service consumer
 	ConsumerPlmnID *PlmnID `json:"consumerPlmnID,omitempty"`
@@ -31,6 +37,18 @@ type AccessTokenClaims struct {
 	ProducerNsiList []string `json:"producerNsiList,omitempty"`
 	// NF Set ID of the NF service producer
 	ProducerNfSetID string `json:"producerNfSetId,omitempty"`
+	// the SNPN of the NF service consumer
+	ConsumerSnpnID *PlmnIDNid `json:"consumerSnpnId,omitempty"`
+	// the SNPN of the NF service producer
+	ProducerSnpnID *PlmnIDNid `json:"producerSnpnId,omitempty"`
+	// the confirmation of the certificate bound token defined in RFC 8705
+	Cnf *Confirmation `json:"cnf,omitempty"`
+}
+
+// Confirmation the confirmation claim binds the token to the client certificate
+type Confirmation struct {
+	// base64url-encoded SHA-256 thumbprint of the client certificate
+	X5tS256 string `json:"x5t#S256"`
 }
 
 // NewAccessTokenClaims create a AccessTokenClaims object
@@ -43,6 +61,30 @@ func (atc *AccessTokenClaims) ToJSON() ([]byte, error) {
 	return json.Marshal(atc)
 }
 
+// GetScopes get the granted scope components
+func (atc *AccessTokenClaims) GetScopes() []string {
+	return ParseScope(atc.Scope)
+}
+
+// HasScope return true if all the components of the space-delimited scope
+// are granted by the token
+func (atc *AccessTokenClaims) HasScope(scope string) bool {
+	granted := atc.GetScopes()
+	for _, s := range ParseScope(scope) {
+		covered := false
+		for _, g := range granted {
+			if IsScopeCoveredBy(s, g) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
 // ToJwtToken convert the AccessTokenClaims object to jwt.Token object
 func (atc *AccessTokenClaims) ToJwtToken() jwt.Token {
 	token := jwt.New()
@@ -51,6 +93,15 @@ func (atc *AccessTokenClaims) ToJwtToken() jwt.Token {
 	token.Set(jwt.AudienceKey, atc.Aud)
 	token.Set("scope", atc.Scope)
 	token.Set(jwt.ExpirationKey, atc.Exp)
+	if atc.Iat > 0 {
+		token.Set(jwt.IssuedAtKey, atc.Iat)
+	}
+	if atc.Nbf > 0 {
+		token.Set(jwt.NotBeforeKey, atc.Nbf)
+	}
+	if len(atc.Jti) > 0 {
+		token.Set(jwt.JwtIDKey, atc.Jti)
+	}
 	if atc.ConsumerPlmnID != nil {
 		token.Set("consumerPlmnID", atc.ConsumerPlmnID)
 	}
@@ -66,6 +117,15 @@ func (atc *AccessTokenClaims) ToJwtToken() jwt.Token {
 	if len(atc.ProducerNfSetID) > 0 {
 		token.Set("producerNfSetId", atc.ProducerNfSetID)
 	}
+	if atc.ConsumerSnpnID != nil {
+		token.Set("consumerSnpnId", atc.ConsumerSnpnID)
+	}
+	if atc.ProducerSnpnID != nil {
+		token.Set("producerSnpnId", atc.ProducerSnpnID)
+	}
+	if atc.Cnf != nil {
+		token.Set("cnf", atc.Cnf)
+	}
 	return token
 }
 
@@ -76,6 +136,13 @@ func (atc *AccessTokenClaims) FromJwtToken(token jwt.Token) error {
 	atc.Sub = token.Subject()
 	atc.Aud = token.Audience()
 	atc.Exp = token.Expiration().Unix()
+	if !token.IssuedAt().IsZero() {
+		atc.Iat = token.IssuedAt().Unix()
+	}
+	if !token.NotBefore().IsZero() {
+		atc.Nbf = token.NotBefore().Unix()
+	}
+	atc.Jti = token.JwtID()
 
 	if scope, ok := token.Get("scope"); ok {
 		if v, ok := scope.(string); ok {
@@ -138,5 +205,38 @@ func (atc *AccessTokenClaims) FromJwtToken(token jwt.Token) error {
 		}
 	}
 
+	if p, ok := token.Get("consumerSnpnId"); ok {
+		if b, err := json.Marshal(p); err == nil {
+			atc.ConsumerSnpnID = &PlmnIDNid{}
+			if err = json.Unmarshal(b, atc.ConsumerSnpnID); err != nil {
+				return err
+			}
+		} else {
+			return fmt.Errorf("Fail to decode consumerSnpnId")
+		}
+	}
+
+	if p, ok := token.Get("producerSnpnId"); ok {
+		if b, err := json.Marshal(p); err == nil {
+			atc.ProducerSnpnID = &PlmnIDNid{}
+			if err = json.Unmarshal(b, atc.ProducerSnpnID); err != nil {
+				return err
+			}
+		} else {
+			return fmt.Errorf("Fail to decode producerSnpnId")
+		}
+	}
+
+	if p, ok := token.Get("cnf"); ok {
+		if b, err := json.Marshal(p); err == nil {
+			atc.Cnf = &Confirmation{}
+			if err = json.Unmarshal(b, atc.Cnf); err != nil {
+				return err
+			}
+		} else {
+			return fmt.Errorf("Fail to decode cnf")
+		}
+	}
+
 	return nil
 }
@@ -1,11 +1,13 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
-	"github.com/ajg/form"
+	"fmt"
 	log "github.com/sirupsen/logrus"
 	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
 )
 
 // AllNFTypes all the NFType defines in the 5G network
@@ -118,53 +120,146 @@ func IsValidServiceName(serviceName string) bool {
 	return ok
 }
 
+// GetServiceNfType get the NF type of the NF offering the service, for
+// example "UDM" for "nudm-sdm", empty if the service name is not valid
+func GetServiceNfType(serviceName string) string {
+	if !IsValidServiceName(serviceName) {
+		return ""
+	}
+	pos := strings.Index(serviceName, "-")
+	nfType := strings.ToUpper(serviceName[1:pos])
+	switch nfType {
+	case "5G":
+		return "5G_EIR"
+	case "SORAF":
+		return "SOR_AF"
+	}
+	return nfType
+}
+
 // PlmnID the PlmnID defined in 5G
 type PlmnID struct {
 	// 3 digital
-	Mcc string `json:"mcc" form:"mcc"`
+	Mcc string `json:"mcc"`
 	// 2 or 2 digital
-	Mnc string `json:"mnc" form:"mnc"`
+	Mnc string `json:"mnc"`
+}
+
+func (p *PlmnID) String() string {
+	return p.Mcc + "-" + p.Mnc
+}
+
+// Equal return true if the two PlmnID have same mcc and mnc
+func (p *PlmnID) Equal(other *PlmnID) bool {
+	return other != nil && p.Mcc == other.Mcc && p.Mnc == other.Mnc
 }
 
 // Snssai the Snssai defined in 5G
 type Snssai struct {
 	// [0,255]
-	Sst int32  `json:"sst" form:"sst"`
+	Sst int32  `json:"sst"`
 	Sd  string `json:"sd,omitempty"`
 }
 
+// Equal return true if the two Snssai have same sst and sd
+func (s *Snssai) Equal(other *Snssai) bool {
+	return other != nil && s.Sst == other.Sst && s.Sd == other.Sd
+}
+
 // PlmnIDNid the PlmnIDNid defined in 5G
 type PlmnIDNid struct {
-	Mcc string `json:"mcc" form:"mcc"`
-	Mnc string `json:"mnc" form:"mnc"`
+	Mcc string `json:"mcc"`
+	Mnc string `json:"mnc"`
 	// pattern: ^[A-Fa-f0-9]{11}$
 	Nid string `json:"nid,omitempty"`
 }
 
+// IsValidNid return true if the nid is 11 hexadecimal digits
+func IsValidNid(nid string) bool {
+	return nidPattern.MatchString(nid)
+}
+
+// Equal return true if the two PlmnIDNid have same mcc, mnc and nid. The
+// case of the hexadecimal digits in nid is ignored
+func (p *PlmnIDNid) Equal(other *PlmnIDNid) bool {
+	return other != nil && p.Mcc == other.Mcc && p.Mnc == other.Mnc && strings.EqualFold(p.Nid, other.Nid)
+}
+
+func (p *PlmnIDNid) String() string {
+	if len(p.Nid) > 0 {
+		return p.Mcc + "-" + p.Mnc + "-" + p.Nid
+	}
+	return p.Mcc + "-" + p.Mnc
+}
+
 // AccessTokenRequest a request to get a token from authorization server
 // the fields without 'omitempty' are mandatory fields, they must
 // be set before sending a access token request to authorization server
 type AccessTokenRequest struct {
-	GrantType string `json:"grant_type" form:"grant_type"`
+	GrantType string `json:"grant_type"`
 	// in uuid format
-	NfInstanceID string `json:"nfInstanceId" form:"nfInstanceId"`
+	NfInstanceID string `json:"nfInstanceId"`
 	// NFType in TS29501_Nnrf_NFManagement.yaml clause 6.1.6.3.3
-	NfType       string `json:"nfType,omitempty" form:"nfType,omitempty"`
-	TargetNfType string `json:"targetNfType,omitempty" form:"targetNfType,omitempty"`
+	NfType       string `json:"nfType,omitempty"`
+	TargetNfType string `json:"targetNfType,omitempty"`
 	// in uuid format
-	TargetNfInstanceID string `json:"targetNfInstanceID,emitempty" form:"targetNfInstanceID,omitempty"`
-	// defined in TS 29.510 6.1.6.3.11
-	Scope                string       `json:"scope" form:"scope,required"`
-	RequesterPlmn        *PlmnID      `json:"targetNfInstanceID,omitempty" form:"targetNfInstanceID,omitempty"`
-	RequesterPlmnList    []*PlmnID    `json:"requesterPlmnList,omitempty" form:"requesterPlmnList,omitempty"`
-	RequesterSnssaiList  []*Snssai    `json:"requesterSnssaiList,omitempty" form:"requesterSnssaiList,omitempty"`
-	RequesterFqdn        string       `json:"requesterFqdn,omitempty" form:"requesterFqdn,omitempty"`
-	RequesterSnpnList    []*PlmnIDNid `json:"requesterSnpnList,omitempty" form:"requesterSnpnList,omitempty"`
-	TargetPlmn           *PlmnID      `json:"targetPlmn,omitempty" form:"targetPlmn,omitempty"`
-	TargetSnssaiList     []*Snssai    `json:"targetSnssaiList,omitempty" form:"targetSnssaiList,omitempty"`
-	TargetNsiList        []string     `json:"targetNsiList,omitempty" form:"targetNsiList,omitempty"`
-	TargetNfSetID        string       `json:"targetNfSetId,omitempty" form:"targetNfSetId,omitempty"`
-	TargetNfServiceSetID string       `json:"targetNfServiceSetId,omitempty" form:"targetNfServiceSetId,omitempty"`
+	TargetNfInstanceID string `json:"targetNfInstanceId,omitempty"`
+	// space-delimited service names defined in TS 29.510 6.1.6.3.11 or
+	// resource/operation-level scopes
+	Scope                string       `json:"scope"`
+	RequesterPlmn        *PlmnID      `json:"requesterPlmn,omitempty"`
+	RequesterPlmnList    []*PlmnID    `json:"requesterPlmnList,omitempty"`
+	RequesterSnssaiList  []*Snssai    `json:"requesterSnssaiList,omitempty"`
+	RequesterFqdn        string       `json:"requesterFqdn,omitempty"`
+	RequesterSnpnList    []*PlmnIDNid `json:"requesterSnpnList,omitempty"`
+	TargetPlmn           *PlmnID      `json:"targetPlmn,omitempty"`
+	TargetSnpn           *PlmnIDNid   `json:"targetSnpn,omitempty"`
+	TargetSnssaiList     []*Snssai    `json:"targetSnssaiList,omitempty"`
+	TargetNsiList        []string     `json:"targetNsiList,omitempty"`
+	TargetNfSetID        string       `json:"targetNfSetId,omitempty"`
+	TargetNfServiceSetID string       `json:"targetNfServiceSetId,omitempty"`
+	// the URI of the access token service of the NRF in the home PLMN
+	HnrfAccessTokenURI string `json:"hnrfAccessTokenUri,omitempty"`
+	// in uuid format, the NF instance on behalf of which the token is requested
+	SourceNfInstanceID string `json:"sourceNfInstanceId,omitempty"`
+	// the client credentials assertion(CCA) defined in TS 33.501 clause 13.3.8
+	ClientAssertion     string `json:"client_assertion,omitempty"`
+	ClientAssertionType string `json:"client_assertion_type,omitempty"`
+}
+
+// formAttribute a attribute of the AccessTokenRequest in the
+// application/x-www-form-urlencoded format. The value of the complex type
+// is encoded in JSON as defined in TS 29.510 clause 6.3.5.2.2
+type formAttribute struct {
+	name string
+	// the attribute of string type
+	str *string
+	// the pointer to the attribute of complex type
+	value interface{}
+}
+
+func (atr *AccessTokenRequest) formAttributes() []formAttribute {
+	return []formAttribute{{name: "grant_type", str: &atr.GrantType},
+		{name: "nfInstanceId", str: &atr.NfInstanceID},
+		{name: "nfType", str: &atr.NfType},
+		{name: "targetNfType", str: &atr.TargetNfType},
+		{name: "scope", str: &atr.Scope},
+		{name: "targetNfInstanceId", str: &atr.TargetNfInstanceID},
+		{name: "requesterPlmn", value: &atr.RequesterPlmn},
+		{name: "requesterPlmnList", value: &atr.RequesterPlmnList},
+		{name: "requesterSnssaiList", value: &atr.RequesterSnssaiList},
+		{name: "requesterFqdn", str: &atr.RequesterFqdn},
+		{name: "requesterSnpnList", value: &atr.RequesterSnpnList},
+		{name: "targetPlmn", value: &atr.TargetPlmn},
+		{name: "targetSnpn", value: &atr.TargetSnpn},
+		{name: "targetSnssaiList", value: &atr.TargetSnssaiList},
+		{name: "targetNsiList", value: &atr.TargetNsiList},
+		{name: "targetNfSetId", str: &atr.TargetNfSetID},
+		{name: "targetNfServiceSetId", str: &atr.TargetNfServiceSetID},
+		{name: "hnrfAccessTokenUri", str: &atr.HnrfAccessTokenURI},
+		{name: "sourceNfInstanceId", str: &atr.SourceNfInstanceID},
+		{name: "client_assertion", str: &atr.ClientAssertion},
+		{name: "client_assertion_type", str: &atr.ClientAssertionType}}
 }
 
 // NewAccessTokenRequest create a AccessTokenRequest object
@@ -178,22 +273,54 @@ func (atr *AccessTokenRequest) ToJSON() ([]byte, error) {
 }
 
 // ToX3WFormEncoding encode the AccessTokenRequest object to
-// application/x-www-form-urlencoded format
+// application/x-www-form-urlencoded format. The empty attributes are omitted
+// and the attributes of complex type are encoded in JSON
 func (atr *AccessTokenRequest) ToX3WFormEncoding() ([]byte, error) {
-	w := bytes.NewBuffer(make([]byte, 0))
-	encoder := form.NewEncoder(w)
-	err := encoder.Encode(atr)
-	if err != nil {
-		return nil, err
+	values := url.Values{}
+	for _, attr := range atr.formAttributes() {
+		if attr.str != nil {
+			if len(*attr.str) > 0 {
+				values.Set(attr.name, *attr.str)
+			}
+			continue
+		}
+		b, err := json.Marshal(attr.value)
+		if err != nil {
+			return nil, err
+		}
+		if v := string(b); v != "null" && v != "[]" {
+			values.Set(attr.name, v)
+		}
 	}
-	return w.Bytes(), nil
+	return []byte(values.Encode()), nil
 }
 
 // FromX3WFormEncoding create AccessTokenRequest object from application/x-www-form-urlencoded
-// format
+// format. The unknown parameters are ignored and the parameter must not be repeated
 func (atr *AccessTokenRequest) FromX3WFormEncoding(r io.Reader) error {
-	decoder := form.NewDecoder(r)
-	return decoder.Decode(atr)
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	values, err := url.ParseQuery(string(b))
+	if err != nil {
+		return err
+	}
+	for _, attr := range atr.formAttributes() {
+		v, ok := values[attr.name]
+		if !ok {
+			continue
+		}
+		if len(v) > 1 {
+			return fmt.Errorf("The parameter %s is repeated", attr.name)
+		}
+		if attr.str != nil {
+			*attr.str = v[0]
+		} else if err = json.Unmarshal([]byte(v[0]), attr.value); err != nil {
+			return fmt.Errorf("Invalid %s with error:%v", attr.name, err)
+		}
+	}
+	return nil
 }
 
 // FromJSON create AccessTokenRequest object from json
@@ -206,34 +333,51 @@ func (atr *AccessTokenRequest) FromJSON(reader io.Reader) error {
 // satisfy:
 // - grant_type must be "client_credentials"
 // - nfInstanceId should not be empty
-// - scope must be a valid service name
+// - the fields must be in the formats checked by Validate
+// - scope must be space-delimited valid service names or resource/operation-level scopes
 func (atr *AccessTokenRequest) CheckValid() *AccessTokenError {
 	if atr.GrantType != "client_credentials" {
 		log.Error("the grant_type ", atr.GrantType, " is not client_credentials")
 		return NewAccessTokenError(UnsupportedGrantType)
 	}
-
-	if len(atr.NfType) > 0 && !IsValidNFType(atr.NfType) {
-		log.Error("Invalid nfType ", atr.NfType)
-		return NewAccessTokenError(InvalidRequest)
-	}
-
-	if len(atr.TargetNfType) > 0 && !IsValidNFType(atr.TargetNfType) {
-		log.Error("Invalid targetNfType", atr.TargetNfType)
-		return NewAccessTokenError(InvalidRequest)
-	}
 	if len(atr.NfInstanceID) <= 0 {
 		log.Error("Missing nfInstanceId")
 		return NewAccessTokenError(InvalidClient)
 	}
-	if !IsValidServiceName(atr.Scope) {
-		log.Error("Not valid scope ", atr.Scope)
+	if accessTokenErr := atr.Validate(); accessTokenErr != nil {
+		log.Error("Invalid request: ", accessTokenErr.ErrorDescription)
+		return accessTokenErr
+	}
+	scopes := ParseScope(atr.Scope)
+	if len(scopes) <= 0 {
+		log.Error("Missing scope")
 		return NewAccessTokenError(InvalidScope)
 	}
+	for _, scope := range scopes {
+		if !IsValidScope(scope) {
+			log.Error("Not valid scope ", scope)
+			return NewAccessTokenError(InvalidScope)
+		}
+	}
 	return nil
 
 }
 
+// GetRequesterSnpn get the SNPN of the consumer, which is the one in the
+// requesterSnpnList with the same PLMN ID and NID as the targetSnpn, or the
+// first one if no targetSnpn. Return nil if the consumer is not in a SNPN
+func (atr *AccessTokenRequest) GetRequesterSnpn() *PlmnIDNid {
+	if len(atr.RequesterSnpnList) <= 0 {
+		return nil
+	}
+	for _, snpn := range atr.RequesterSnpnList {
+		if snpn.Equal(atr.TargetSnpn) {
+			return snpn
+		}
+	}
+	return atr.RequesterSnpnList[0]
+}
+
 // IsRequestByType check if access token by the NFType
 // if both nfType and targetNfType are valid and setting,
 // the request is a token access request by NFType
@@ -243,3 +387,44 @@ func (atr *AccessTokenRequest) IsRequestByType() bool {
 	}
 	return false
 }
+
+// GetTokenCacheKey get the key of the cached token for the request by type or
+// by instance. All the request parameters copied into the token claims are
+// part of the key, so the requests differing in them don't share the token
+func (atr *AccessTokenRequest) GetTokenCacheKey() (string, bool) {
+	var key string
+	if atr.IsRequestByInstance() {
+		key = fmt.Sprintf("%s@instance-%s-%s", atr.NfInstanceID, atr.TargetNfInstanceID, atr.Scope)
+	} else if atr.IsRequestByType() {
+		key = fmt.Sprintf("%s@%s-%s-%s", atr.NfInstanceID, atr.NfType, atr.TargetNfType, atr.Scope)
+	} else {
+		return "", false
+	}
+	claims, err := json.Marshal(&struct {
+		RequesterPlmn        *PlmnID      `json:"requesterPlmn,omitempty"`
+		RequesterSnpnList    []*PlmnIDNid `json:"requesterSnpnList,omitempty"`
+		TargetPlmn           *PlmnID      `json:"targetPlmn,omitempty"`
+		TargetSnpn           *PlmnIDNid   `json:"targetSnpn,omitempty"`
+		TargetSnssaiList     []*Snssai    `json:"targetSnssaiList,omitempty"`
+		TargetNsiList        []string     `json:"targetNsiList,omitempty"`
+		TargetNfServiceSetID string       `json:"targetNfServiceSetId,omitempty"`
+	}{
+		RequesterPlmn:        atr.RequesterPlmn,
+		RequesterSnpnList:    atr.RequesterSnpnList,
+		TargetPlmn:           atr.TargetPlmn,
+		TargetSnpn:           atr.TargetSnpn,
+		TargetSnssaiList:     atr.TargetSnssaiList,
+		TargetNsiList:        atr.TargetNsiList,
+		TargetNfServiceSetID: atr.TargetNfServiceSetID,
+	})
+	if err != nil {
+		return "", false
+	}
+	return key + string(claims), true
+}
+
+// IsRequestByInstance check if access token is requested for a specific
+// NF service producer instance, identified by the targetNfInstanceId
+func (atr *AccessTokenRequest) IsRequestByInstance() bool {
+	return len(atr.TargetNfInstanceID) > 0
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"net/url"
+	"reflect"
 	"testing"
 )
 
@@ -10,7 +12,7 @@ func TestAccessTokenRequestMandatoryFields(t *testing.T) {
 	//s := `{"grant_type":"client_credentials","nfInstanceId":"123","scope":"NMF","requesterPlmnList":[{"mcc":"281","123"}]}`
 	atr := NewAccessTokenRequest()
 	atr.GrantType = "client_credentials"
-	atr.NfInstanceID = "123"
+	atr.NfInstanceID = "5a7bd676-ceeb-44bb-95e0-f6a55a300123"
 	atr.Scope = "NMF"
 	p1 := PlmnID{Mcc: "081", Mnc: "123"}
 	atr.RequesterPlmnList = []*PlmnID{&p1}
@@ -33,13 +35,181 @@ func TestAccessTokenRequestMandatoryFields(t *testing.T) {
 }
 
 func TestAccessTokenRequestDecodeFromEncoding(t *testing.T) {
-	s := "grant_type=client_credentials&nfInstanceId=123&scope=NMF&requesterPlmnList.0.mcc=281&requesterPlmnList.0.mnc=123"
+	s := "grant_type=client_credentials&nfInstanceId=5a7bd676-ceeb-44bb-95e0-f6a55a300123&nfType=AMF&targetNfType=UDM&scope=nudm-sdm" +
+		"&requesterPlmn=%7B%22mcc%22%3A%22281%22%2C%22mnc%22%3A%22123%22%7D" +
+		"&targetSnssaiList=%5B%7B%22sst%22%3A1%2C%22sd%22%3A%22000001%22%7D%5D" +
+		"&targetNsiList=%5B%22nsi-1%22%5D&unknown=1"
 	atr := NewAccessTokenRequest()
-	r := bytes.NewBufferString(s)
-	err := atr.FromX3WFormEncoding(r)
+	if err := atr.FromX3WFormEncoding(bytes.NewBufferString(s)); err != nil {
+		t.Fatal(err)
+	}
+	if atr.NfType != "AMF" || !atr.RequesterPlmn.Equal(&PlmnID{Mcc: "281", Mnc: "123"}) ||
+		len(atr.TargetSnssaiList) != 1 || !atr.TargetSnssaiList[0].Equal(&Snssai{Sst: 1, Sd: "000001"}) ||
+		len(atr.TargetNsiList) != 1 || atr.TargetNsiList[0] != "nsi-1" {
+		b, _ := atr.ToJSON()
+		t.Error("Unexpected decoded request ", string(b))
+	}
+	for _, s = range []string{"grant_type=client_credentials&scope=nudm-sdm&scope=nudm-uecm",
+		"grant_type=client_credentials&requesterPlmn=%7B%22mcc%22%3A281%7D"} {
+		if NewAccessTokenRequest().FromX3WFormEncoding(bytes.NewBufferString(s)) == nil {
+			t.Error("The malformed request should be rejected ", s)
+		}
+	}
+}
+
+func TestAccessTokenRequestSpecExamples(t *testing.T) {
+	// the form bodies encoded as in the examples of TS 29.510 clause
+	// 6.3.5.2.2, decoded exactly as written without re-encoding
+	s := "grant_type=client_credentials&nfInstanceId=3fa85f64-5717-4562-b3fc-2c963f66afa6&nfType=AMF&targetNfType=UDM" +
+		"&scope=nudm-sdm+nudm-uecm&targetNfInstanceId=8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001" +
+		"&requesterPlmn=%7B%22mcc%22%3A%22001%22%2C%22mnc%22%3A%2201%22%7D" +
+		"&requesterPlmnList=%5B%7B%22mcc%22%3A%22001%22%2C%22mnc%22%3A%2202%22%7D%2C%7B%22mcc%22%3A%22001%22%2C%22mnc%22%3A%22003%22%7D%5D" +
+		"&requesterSnssaiList=%5B%7B%22sst%22%3A1%2C%22sd%22%3A%22A08923%22%7D%2C%7B%22sst%22%3A2%7D%5D" +
+		"&requesterFqdn=amf1.cluster1.net2.amf.5gc.mnc001.mcc001.3gppnetwork.org" +
+		"&targetPlmn=%7B%22mcc%22%3A%22001%22%2C%22mnc%22%3A%2201%22%7D" +
+		"&targetSnssaiList=%5B%7B%22sst%22%3A1%2C%22sd%22%3A%22A08923%22%7D%5D" +
+		"&targetNsiList=%5B%22nsi1%22%2C%22nsi2%22%5D"
+	atr := NewAccessTokenRequest()
+	if err := atr.FromX3WFormEncoding(bytes.NewBufferString(s)); err != nil {
+		t.Fatal(err)
+	}
+	expected := NewAccessTokenRequest()
+	expected.GrantType = "client_credentials"
+	expected.NfInstanceID = "3fa85f64-5717-4562-b3fc-2c963f66afa6"
+	expected.NfType = "AMF"
+	expected.TargetNfType = "UDM"
+	expected.Scope = "nudm-sdm nudm-uecm"
+	expected.TargetNfInstanceID = "8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001"
+	expected.RequesterPlmn = &PlmnID{Mcc: "001", Mnc: "01"}
+	expected.RequesterPlmnList = []*PlmnID{&PlmnID{Mcc: "001", Mnc: "02"}, &PlmnID{Mcc: "001", Mnc: "003"}}
+	expected.RequesterSnssaiList = []*Snssai{&Snssai{Sst: 1, Sd: "A08923"}, &Snssai{Sst: 2}}
+	expected.RequesterFqdn = "amf1.cluster1.net2.amf.5gc.mnc001.mcc001.3gppnetwork.org"
+	expected.TargetPlmn = &PlmnID{Mcc: "001", Mnc: "01"}
+	expected.TargetSnssaiList = []*Snssai{&Snssai{Sst: 1, Sd: "A08923"}}
+	expected.TargetNsiList = []string{"nsi1", "nsi2"}
+	if !reflect.DeepEqual(expected, atr) {
+		b, _ := atr.ToJSON()
+		t.Error("Unexpected decoded request ", string(b))
+	}
+	if accessTokenErr := atr.CheckValid(); accessTokenErr != nil {
+		t.Error("The request should be valid ", accessTokenErr.ErrorDescription)
+	}
+
+	// the SNPN attributes and the JSON values not percent-encoded
+	s = "grant_type=client_credentials&nfInstanceId=3fa85f64-5717-4562-b3fc-2c963f66afa6&nfType=AMF&targetNfType=UDM&scope=nudm-sdm" +
+		`&requesterSnpnList=[{"mcc":"001","mnc":"01","nid":"000007ed9d5"}]` +
+		`&targetSnpn={"mcc":"001","mnc":"01","nid":"000007ed9d6"}`
+	atr = NewAccessTokenRequest()
+	if err := atr.FromX3WFormEncoding(bytes.NewBufferString(s)); err != nil {
+		t.Fatal(err)
+	}
+	if len(atr.RequesterSnpnList) != 1 || !atr.RequesterSnpnList[0].Equal(&PlmnIDNid{Mcc: "001", Mnc: "01", Nid: "000007ed9d5"}) ||
+		!atr.TargetSnpn.Equal(&PlmnIDNid{Mcc: "001", Mnc: "01", Nid: "000007ed9d6"}) {
+		b, _ := atr.ToJSON()
+		t.Error("Unexpected decoded SNPNs ", string(b))
+	}
+
+	// the attribute name of the former releases is not recognized
+	s = "grant_type=client_credentials&nfInstanceId=3fa85f64-5717-4562-b3fc-2c963f66afa6&targetNfInstanceID=8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001"
+	atr = NewAccessTokenRequest()
+	if err := atr.FromX3WFormEncoding(bytes.NewBufferString(s)); err != nil || len(atr.TargetNfInstanceID) > 0 {
+		t.Error("The targetNfInstanceID should be ignored as an unknown parameter")
+	}
+}
+
+func TestAccessTokenRequestFormRoundTrip(t *testing.T) {
+	atr := NewAccessTokenRequest()
+	atr.GrantType = "client_credentials"
+	atr.NfInstanceID = "5a7bd676-ceeb-44bb-95e0-f6a55a300123"
+	atr.NfType = "AMF"
+	atr.TargetNfType = "UDM"
+	atr.TargetNfInstanceID = "8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001"
+	atr.Scope = "nudm-sdm nudm-uecm"
+	atr.RequesterPlmn = &PlmnID{Mcc: "460", Mnc: "00"}
+	atr.RequesterPlmnList = []*PlmnID{&PlmnID{Mcc: "460", Mnc: "01"}}
+	atr.RequesterSnssaiList = []*Snssai{&Snssai{Sst: 1}}
+	atr.RequesterFqdn = "amf.example.com"
+	atr.RequesterSnpnList = []*PlmnIDNid{&PlmnIDNid{Mcc: "460", Mnc: "00", Nid: "000007ed9d5"}}
+	atr.TargetPlmn = &PlmnID{Mcc: "460", Mnc: "01"}
+	atr.TargetSnpn = &PlmnIDNid{Mcc: "460", Mnc: "01", Nid: "000007ed9d6"}
+	atr.TargetSnssaiList = []*Snssai{&Snssai{Sst: 1, Sd: "000001"}, &Snssai{Sst: 2}}
+	atr.TargetNsiList = []string{"nsi-1", "nsi-2"}
+	atr.TargetNfSetID = "set1.udmset.5gc.mnc001.mcc460"
+	atr.TargetNfServiceSetID = "set1.sn1.nudm-sdm.5gc.mnc001.mcc460"
+	atr.HnrfAccessTokenURI = "https://nrf.5gc.mnc001.mcc460.3gppnetwork.org/oauth2/token"
+	atr.SourceNfInstanceID = "1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001"
+	atr.ClientAssertion = "eyJhbGciOiJSUzI1NiJ9.e30.c2ln"
+	atr.ClientAssertionType = ClientAssertionTypeJWTBearer
+	b, err := atr.ToX3WFormEncoding()
 	if err != nil {
+		t.Fatal(err)
+	}
+	values, _ := url.ParseQuery(string(b))
+	if values.Get("requesterPlmn") != `{"mcc":"460","mnc":"00"}` || values.Get("targetNsiList") != `["nsi-1","nsi-2"]` {
+		t.Error("The complex attributes should be encoded in JSON ", string(b))
+	}
+	decoded := NewAccessTokenRequest()
+	if err = decoded.FromX3WFormEncoding(bytes.NewBuffer(b)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(atr, decoded) {
+		t.Error("The decoded request should be same as the encoded one ", string(b))
+	}
+	if atr.CheckValid() != nil {
+		t.Error("The request should be valid")
+	}
+
+	b, _ = atr.ToJSON()
+	decoded = NewAccessTokenRequest()
+	if err = decoded.FromJSON(bytes.NewBuffer(b)); err != nil || !reflect.DeepEqual(atr, decoded) {
+		t.Error("The request should be same after the JSON round trip ", string(b))
+	}
+
+	b, _ = NewAccessTokenRequest().ToX3WFormEncoding()
+	if len(b) > 0 {
+		t.Error("The empty attributes should be omitted ", string(b))
+	}
+}
+
+func TestAccessTokenRequestMultipleScopes(t *testing.T) {
+	atr := NewAccessTokenRequest()
+	atr.GrantType = "client_credentials"
+	atr.NfInstanceID = "5a7bd676-ceeb-44bb-95e0-f6a55a300123"
+	atr.Scope = "namf-comm namf-evts nudm-sdm:am-data:read"
+	if atr.CheckValid() != nil {
 		t.Fail()
 	}
-	b, _ := atr.ToJSON()
-	fmt.Println(string(b))
+	atr.Scope = "namf-comm NMF"
+	if err := atr.CheckValid(); err == nil || err.Error != InvalidScope {
+		t.Fail()
+	}
+	atr.Scope = " "
+	if err := atr.CheckValid(); err == nil || err.Error != InvalidScope {
+		t.Fail()
+	}
+}
+
+func TestAccessTokenRequestSnpn(t *testing.T) {
+	atr := NewAccessTokenRequest()
+	atr.GrantType = "client_credentials"
+	atr.NfInstanceID = "5a7bd676-ceeb-44bb-95e0-f6a55a300123"
+	atr.Scope = "namf-comm"
+	atr.RequesterSnpnList = []*PlmnIDNid{&PlmnIDNid{Mcc: "460", Mnc: "00", Nid: "000007ed9d5"},
+		&PlmnIDNid{Mcc: "460", Mnc: "00", Nid: "000007ED9D6"}}
+	atr.TargetSnpn = &PlmnIDNid{Mcc: "460", Mnc: "00", Nid: "000007ed9d6"}
+	if atr.CheckValid() != nil {
+		t.Error("The request with valid NIDs should be accepted")
+	}
+	if atr.GetRequesterSnpn() != atr.RequesterSnpnList[1] {
+		t.Error("The SNPN of the consumer should be the target SNPN")
+	}
+	atr.TargetSnpn.Nid = "000007ed9d"
+	if err := atr.CheckValid(); err == nil || err.Error != InvalidRequest {
+		t.Error("The targetSnpn with invalid NID should be rejected")
+	}
+	atr.TargetSnpn = nil
+	atr.RequesterSnpnList[0].Nid = "000007ed9dx"
+	if err := atr.CheckValid(); err == nil || err.Error != InvalidRequest {
+		t.Error("The requesterSnpnList with invalid NID should be rejected")
+	}
 }
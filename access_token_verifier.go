@@ -2,8 +2,10 @@ package main
 
 import (
 	"bytes"
+	"crypto/x509"
 	"fmt"
 	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jws"
 	"github.com/lestrrat-go/jwx/jwt"
 	log "github.com/sirupsen/logrus"
 	"time"
@@ -16,45 +18,180 @@ import (
 // the specified signature algorithm and the key
 type AccessTokenVerifier struct {
 	alg                jwa.SignatureAlgorithm
-	key                interface{}
+	keySource          VerificationKeySource
 	verifiedTokenCache *TokenVerifyCache
+	// reject the revoked tokens if it is set
+	revocationList *RevocationList
+	// the expected claims checked by VerifyTokenClaims
+	options *VerificationOptions
+	// the allowed clock difference between the authorization server and
+	// the verifier when checking the exp, nbf and iat
+	clockSkew int64
 }
 
 // NewAccessTokenVerifier create a AccessTokenVerifier object with the specific signature
 // algorithm and its key
 func NewAccessTokenVerifier(alg jwa.SignatureAlgorithm, key interface{}) *AccessTokenVerifier {
 	log.Info("create verifier with algorithm ", alg, " and key ", fmt.Sprintf("%T", key))
+	return NewAccessTokenVerifierWithKeySource(alg, NewStaticKeySource(key))
+}
+
+// NewAccessTokenVerifierWithKeySource create a AccessTokenVerifier object with the specific
+// signature algorithm and the source of the keys. The key to verify a token is selected
+// from the keySource by the kid in the token header
+func NewAccessTokenVerifierWithKeySource(alg jwa.SignatureAlgorithm, keySource VerificationKeySource) *AccessTokenVerifier {
 	return &AccessTokenVerifier{alg: alg,
-		key:                key,
+		keySource:          keySource,
 		verifiedTokenCache: NewTokenVerifyCache()}
 }
 
+// SetRevocationList set the revocation list, the revoked token is rejected
+// even if it was verified before
+func (atv *AccessTokenVerifier) SetRevocationList(revocationList *RevocationList) {
+	atv.revocationList = revocationList
+}
+
+// SetVerificationOptions set the expected claims, for example the aud and the
+// PLMN of the producer, checked in every verification
+func (atv *AccessTokenVerifier) SetVerificationOptions(options *VerificationOptions) {
+	atv.options = options
+}
+
+// SetClockSkew set the allowed clock difference between the authorization
+// server and the verifier
+func (atv *AccessTokenVerifier) SetClockSkew(clockSkew time.Duration) {
+	atv.clockSkew = int64(clockSkew.Seconds())
+}
+
+// GetVerificationOptions get the expected claims, nil if no claim is checked
+func (atv *AccessTokenVerifier) GetVerificationOptions() *VerificationOptions {
+	return atv.options
+}
+
+func (atv *AccessTokenVerifier) isRevoked(atc *AccessTokenClaims) bool {
+	return atv.revocationList != nil && atv.revocationList.IsRevoked(atc)
+}
+
 // VerifyToken verify the token with the signature algoritm and the key. If the token
 // is valid and not expired, return nil
 func (atv *AccessTokenVerifier) VerifyToken(b []byte) error {
+	_, err := atv.VerifyTokenClaims(b)
+	return err
+}
 
-	if atv.verifiedTokenCache.IsTokenVerified(string(b)) {
-		return nil
+// VerifyTokenClaims verify the token with the signature algoritm and the key selected by the
+// kid in the token header. If the token
+// is valid, not expired and its claims match the verification options, return its claims.
+// The granted scope can be checked with the AccessTokenClaims.HasScope
+func (atv *AccessTokenVerifier) VerifyTokenClaims(b []byte) (*AccessTokenClaims, error) {
+	return atv.VerifyTokenWithOptions(b, atv.options)
+}
+
+// VerifyTokenWithOptions verify the token like VerifyTokenClaims but check its
+// claims against the options instead of the options set by SetVerificationOptions.
+// A *ClaimError is returned if a claim check fails
+func (atv *AccessTokenVerifier) VerifyTokenWithOptions(b []byte, options *VerificationOptions) (*AccessTokenClaims, error) {
+	atc, err := atv.verifySignature(b)
+	if err != nil {
+		return nil, err
 	}
+	if err = options.Validate(atc); err != nil {
+		return nil, err
+	}
+	return atc, nil
+}
 
-	if atv.key == nil {
-		return fmt.Errorf("Fail to verify token because key is nil")
+// verifySignature verify the signature, the expiration time and the revocation
+// of the token
+func (atv *AccessTokenVerifier) verifySignature(b []byte) (*AccessTokenClaims, error) {
+	if atc, ok := atv.verifiedTokenCache.GetVerifiedToken(string(b)); ok {
+		if atv.isRevoked(atc) {
+			return nil, fmt.Errorf("The token %s is revoked", atc.Jti)
+		}
+		return atc, nil
+	}
+
+	msg, err := jws.Parse(bytes.NewBuffer(b))
+	if err != nil {
+		return nil, err
 	}
-	token, err := jwt.Parse(bytes.NewBuffer(b), jwt.WithVerify(atv.alg, atv.key))
+	if len(msg.Signatures()) != 1 {
+		return nil, fmt.Errorf("Only one signature is allowed in token")
+	}
+	headers := msg.Signatures()[0].ProtectedHeaders()
+	if headers.Algorithm() != atv.alg {
+		return nil, fmt.Errorf("The signature algorithm %s is not %s", headers.Algorithm(), atv.alg)
+	}
+	alg, key, err := atv.keySource.GetKey(headers.KeyID())
+	if err != nil {
+		return nil, err
+	}
+	if len(alg) > 0 && alg != atv.alg {
+		return nil, fmt.Errorf("The key %s is for algorithm %s instead of %s", headers.KeyID(), alg, atv.alg)
+	}
+	token, err := jwt.Parse(bytes.NewBuffer(b), jwt.WithVerify(atv.alg, key))
 	if err != nil {
-		return err
+		return nil, err
 	}
 	atc := NewAccessTokenClaims()
 	err = atc.FromJwtToken(token)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	if err = atv.checkTime(atc); err != nil {
+		return nil, err
+	}
+	if atv.isRevoked(atc) {
+		return nil, fmt.Errorf("The token %s is revoked", atc.Jti)
+	}
+	atv.verifiedTokenCache.AddVerifiedToken(string(b), atc)
+
+	return atc, nil
+}
+
+// checkTime check the exp, nbf and iat against the current time with the clock skew
+func (atv *AccessTokenVerifier) checkTime(atc *AccessTokenClaims) error {
 	now := time.Now().Unix()
-	if atc.Exp < now {
-		return fmt.Errorf("Expiration time %d is less than current time %d", atc.Exp, now)
+	if atc.Exp+atv.clockSkew < now {
+		return NewClaimError("exp", "expiration time %d is less than current time %d", atc.Exp, now)
+	}
+	if atc.Nbf-atv.clockSkew > now {
+		return NewClaimError("nbf", "not before time %d is greater than current time %d", atc.Nbf, now)
 	}
-	atv.verifiedTokenCache.AddVerifiedToken(string(b), atc.Exp)
+	if atc.Iat-atv.clockSkew > now {
+		return NewClaimError("iat", "issued at time %d is greater than current time %d", atc.Iat, now)
+	}
+	return nil
+}
 
-	return err
+// VerifyTokenWithCertificate verify the token presented by the client with
+// the TLS certificate cert. If the token is a certificate bound token, the
+// "x5t#S256" of the "cnf" claim must match the thumbprint of the cert
+func (atv *AccessTokenVerifier) VerifyTokenWithCertificate(b []byte, cert *x509.Certificate) (*AccessTokenClaims, error) {
+	if cert == nil {
+		return atv.VerifyTokenWithThumbprint(b, "")
+	}
+	return atv.VerifyTokenWithThumbprint(b, GetCertificateThumbprint(cert))
+}
+
+// VerifyTokenWithThumbprint verify the token presented by the client with the
+// base64url-encoded SHA-256 thumbprint of its TLS certificate. A certificate bound
+// token is rejected if the certThumbprint is empty or does not match the "x5t#S256"
+// of the "cnf" claim
+func (atv *AccessTokenVerifier) VerifyTokenWithThumbprint(b []byte, certThumbprint string) (*AccessTokenClaims, error) {
+	atc, err := atv.VerifyTokenClaims(b)
+	if err != nil {
+		return nil, err
+	}
+	if atc.Cnf == nil {
+		return atc, nil
+	}
+	if len(certThumbprint) <= 0 {
+		return nil, fmt.Errorf("No client certificate for the certificate bound token")
+	}
+	if atc.Cnf.X5tS256 != certThumbprint {
+		return nil, fmt.Errorf("The client certificate thumbprint %s does not match the x5t#S256 %s", certThumbprint, atc.Cnf.X5tS256)
+	}
+	return atc, nil
 }
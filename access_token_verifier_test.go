@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/lestrrat-go/jwx/jwa"
 	"testing"
+	"time"
 )
 
 var publicKey string = `-----BEGIN PUBLIC KEY-----
@@ -32,3 +33,49 @@ func TestVerify(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestVerifyTokenClaims(t *testing.T) {
+	key, err := loadSignatureKey([]byte(publicKey))
+	if err != nil {
+		t.Fail()
+	}
+
+	token, _ := createToken()
+	verifier := NewAccessTokenVerifier(jwa.RS256, key)
+	for i := 0; i < 2; i++ {
+		atc, err := verifier.VerifyTokenClaims([]byte(token))
+		if err != nil || !atc.HasScope("namf-comm") || atc.HasScope("namf-evts") {
+			t.Fail()
+		}
+	}
+}
+
+func createTokenWithClaims(claims *AccessTokenClaims) (string, error) {
+	key, err := loadSignatureKey([]byte(privateKey))
+	if err != nil {
+		return "", err
+	}
+	return signJWT(claims.ToJwtToken(), NewKeySigner(jwa.RS256, key), "")
+}
+
+func TestVerifyTokenClockSkew(t *testing.T) {
+	key, _ := loadSignatureKey([]byte(publicKey))
+	now := time.Now().Unix()
+	tests := map[string]*AccessTokenClaims{"exp": &AccessTokenClaims{Scope: "namf-comm", Exp: now - 10},
+		"nbf": &AccessTokenClaims{Scope: "namf-comm", Exp: now + 60, Nbf: now + 10},
+		"iat": &AccessTokenClaims{Scope: "namf-comm", Exp: now + 60, Iat: now + 10}}
+	for claim, claims := range tests {
+		token, err := createTokenWithClaims(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifier := NewAccessTokenVerifier(jwa.RS256, key)
+		_, err = verifier.VerifyTokenClaims([]byte(token))
+		expectClaimError(t, err, claim)
+
+		verifier.SetClockSkew(30 * time.Second)
+		if _, err = verifier.VerifyTokenClaims([]byte(token)); err != nil {
+			t.Errorf("The token with %s in clock skew should be accepted: %v", claim, err)
+		}
+	}
+}
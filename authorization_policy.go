@@ -0,0 +1,200 @@
+package main
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+// AuthorizationRule a rule grants the NF service consumers the access to
+// the services of the NF service producers. An empty list in the rule
+// matches anything
+type AuthorizationRule struct {
+	Name string `yaml:"name,omitempty"`
+	// NF types of the NF service consumer
+	ConsumerNfTypes []string `yaml:"consumerNfTypes,omitempty"`
+	// NF instance ids of the NF service consumer
+	ConsumerNfInstanceIDs []string `yaml:"consumerNfInstanceIds,omitempty"`
+	// NF types of the NF service producer
+	TargetNfTypes []string `yaml:"targetNfTypes,omitempty"`
+	// the service names defined in TS 29.510 6.1.6.3.11 or the resource/operation-level
+	// scopes the consumer can access
+	AllowedServices []string `yaml:"allowedServices,omitempty"`
+	// the PLMN of the NF service consumer must be one of them
+	Plmns []*PlmnID `yaml:"plmns,omitempty"`
+	// the requested S-NSSAIs of the NF service producer must be in the list
+	Snssais []*Snssai `yaml:"snssais,omitempty"`
+	// the SNPNs of the NF service consumer must be in the list
+	Snpns []*PlmnIDNid `yaml:"snpns,omitempty"`
+	// the target SNPN of the NF service producer must be in the list
+	TargetSnpns []*PlmnIDNid `yaml:"targetSnpns,omitempty"`
+}
+
+// AuthorizationPolicy the declarative policy evaluated by the authorization
+// server before granting a token. The access is denied if no rule matches
+type AuthorizationPolicy struct {
+	Rules []*AuthorizationRule `yaml:"rules"`
+}
+
+// LoadAuthorizationPolicy load the AuthorizationPolicy from a yaml file
+func LoadAuthorizationPolicy(fileName string) (*AuthorizationPolicy, error) {
+	policy := &AuthorizationPolicy{}
+	err := loadYamlConfig(fileName, policy)
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// Evaluate evaluate the AccessTokenRequest against the rules. The consumerNfType
+// and targetNfType are the resolved NF types of the consumer and producer.
+//
+// Return the granted scope which contains the requested scope components allowed
+// by the matched rules. Return unauthorized_client error if no rule allows the
+// consumer to access the target NF, or invalid_scope error if none of the requested
+// scope components is allowed
+func (ap *AuthorizationPolicy) Evaluate(art *AccessTokenRequest, consumerNfType string, targetNfType string) (string, *AccessTokenError) {
+	matched := false
+	scopes := ParseScope(art.Scope)
+	granted := make([]string, 0)
+	for _, rule := range ap.Rules {
+		if !rule.matchConsumer(art, consumerNfType) ||
+			!matchStringList(rule.TargetNfTypes, targetNfType) ||
+			!rule.matchPlmn(art) ||
+			!rule.matchSnssais(art.TargetSnssaiList) ||
+			!rule.matchSnpn(art) {
+			continue
+		}
+		matched = true
+		remains := make([]string, 0)
+		for _, scope := range scopes {
+			if rule.isScopeAllowed(scope) {
+				log.Debug("Scope ", scope, " from ", art.NfInstanceID, " to ", targetNfType, " is allowed by rule ", rule.Name)
+				granted = append(granted, scope)
+			} else {
+				remains = append(remains, scope)
+			}
+		}
+		scopes = remains
+	}
+	if !matched {
+		log.Error("No rule allows ", art.NfInstanceID, " of type ", consumerNfType, " to access ", targetNfType)
+		return "", NewAccessTokenError(UnauthorizedClient)
+	}
+	if len(granted) <= 0 {
+		log.Error("The scope ", art.Scope, " is not allowed for ", art.NfInstanceID, " to access ", targetNfType)
+		return "", NewAccessTokenError(InvalidScope)
+	}
+	if len(scopes) > 0 {
+		log.Warn("The scope ", FormatScope(scopes), " is not granted to ", art.NfInstanceID)
+	}
+	return FormatScope(granted), nil
+}
+
+func (ar *AuthorizationRule) matchConsumer(art *AccessTokenRequest, consumerNfType string) bool {
+	return matchStringList(ar.ConsumerNfTypes, consumerNfType) &&
+		matchStringList(ar.ConsumerNfInstanceIDs, art.NfInstanceID)
+}
+
+func (ar *AuthorizationRule) matchPlmn(art *AccessTokenRequest) bool {
+	if len(ar.Plmns) <= 0 {
+		return true
+	}
+	plmns := art.RequesterPlmnList
+	if art.RequesterPlmn != nil {
+		plmns = append([]*PlmnID{art.RequesterPlmn}, plmns...)
+	}
+	if len(plmns) <= 0 {
+		return false
+	}
+	for _, plmn := range plmns {
+		if !containsPlmn(ar.Plmns, plmn) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchSnpn check if all the SNPNs of the consumer and the target SNPN are
+// allowed by the rule
+func (ar *AuthorizationRule) matchSnpn(art *AccessTokenRequest) bool {
+	if len(ar.Snpns) > 0 {
+		if len(art.RequesterSnpnList) <= 0 {
+			return false
+		}
+		for _, snpn := range art.RequesterSnpnList {
+			if !containsSnpn(ar.Snpns, snpn) {
+				return false
+			}
+		}
+	}
+	if len(ar.TargetSnpns) > 0 && !containsSnpn(ar.TargetSnpns, art.TargetSnpn) {
+		return false
+	}
+	return true
+}
+
+func (ar *AuthorizationRule) matchSnssais(snssais []*Snssai) bool {
+	if len(ar.Snssais) <= 0 {
+		return true
+	}
+	if len(snssais) <= 0 {
+		return false
+	}
+	for _, snssai := range snssais {
+		if !containsSnssai(ar.Snssais, snssai) {
+			return false
+		}
+	}
+	return true
+}
+
+func (ar *AuthorizationRule) isScopeAllowed(scope string) bool {
+	if len(ar.AllowedServices) <= 0 {
+		return true
+	}
+	for _, allowed := range ar.AllowedServices {
+		if IsScopeCoveredBy(scope, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchStringList return true if the list is empty or the s is in the list
+func matchStringList(list []string, s string) bool {
+	if len(list) <= 0 {
+		return true
+	}
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsPlmn(plmns []*PlmnID, plmn *PlmnID) bool {
+	for _, p := range plmns {
+		if p.Equal(plmn) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsSnpn(snpns []*PlmnIDNid, snpn *PlmnIDNid) bool {
+	for _, s := range snpns {
+		if s.Equal(snpn) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsSnssai(snssais []*Snssai, snssai *Snssai) bool {
+	for _, s := range snssais {
+		if s.Equal(snssai) {
+			return true
+		}
+	}
+	return false
+}
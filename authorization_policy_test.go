@@ -0,0 +1,103 @@
+package main
+
+import (
+	"testing"
+)
+
+func createTestPolicy() *AuthorizationPolicy {
+	return &AuthorizationPolicy{Rules: []*AuthorizationRule{
+		&AuthorizationRule{Name: "lmf-to-amf",
+			ConsumerNfTypes: []string{"LMF"},
+			TargetNfTypes:   []string{"AMF"},
+			AllowedServices: []string{"namf-comm", "namf-loc"}},
+		&AuthorizationRule{Name: "amf-to-udm",
+			ConsumerNfTypes: []string{"AMF"},
+			TargetNfTypes:   []string{"UDM"},
+			AllowedServices: []string{"nudm-sdm"},
+			Plmns:           []*PlmnID{&PlmnID{Mcc: "460", Mnc: "00"}},
+			Snssais:         []*Snssai{&Snssai{Sst: 1}}},
+	}}
+}
+
+func TestAuthorizationPolicyEvaluate(t *testing.T) {
+	policy := createTestPolicy()
+	req := NewAccessTokenRequest()
+	req.NfInstanceID = "1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001"
+	req.Scope = "namf-comm"
+	if _, err := policy.Evaluate(req, "LMF", "AMF"); err != nil {
+		t.Fail()
+	}
+	req.Scope = "namf-evts"
+	if _, err := policy.Evaluate(req, "LMF", "AMF"); err == nil || err.Error != InvalidScope {
+		t.Fail()
+	}
+	req.Scope = "nudm-sdm"
+	if _, err := policy.Evaluate(req, "LMF", "UDM"); err == nil || err.Error != UnauthorizedClient {
+		t.Fail()
+	}
+}
+
+func TestAuthorizationPolicyPlmnAndSnssai(t *testing.T) {
+	policy := createTestPolicy()
+	req := NewAccessTokenRequest()
+	req.NfInstanceID = "8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001"
+	req.Scope = "nudm-sdm"
+	if _, err := policy.Evaluate(req, "AMF", "UDM"); err == nil || err.Error != UnauthorizedClient {
+		t.Fail()
+	}
+	req.RequesterPlmnList = []*PlmnID{&PlmnID{Mcc: "460", Mnc: "00"}}
+	req.TargetSnssaiList = []*Snssai{&Snssai{Sst: 1}}
+	if _, err := policy.Evaluate(req, "AMF", "UDM"); err != nil {
+		t.Fail()
+	}
+	req.TargetSnssaiList = []*Snssai{&Snssai{Sst: 1}, &Snssai{Sst: 2}}
+	if _, err := policy.Evaluate(req, "AMF", "UDM"); err == nil || err.Error != UnauthorizedClient {
+		t.Fail()
+	}
+}
+
+func TestAuthorizationPolicySnpn(t *testing.T) {
+	snpn := &PlmnIDNid{Mcc: "460", Mnc: "00", Nid: "000007ed9d5"}
+	policy := &AuthorizationPolicy{Rules: []*AuthorizationRule{
+		&AuthorizationRule{Name: "snpn-amf-to-udm",
+			ConsumerNfTypes: []string{"AMF"},
+			TargetNfTypes:   []string{"UDM"},
+			Snpns:           []*PlmnIDNid{snpn},
+			TargetSnpns:     []*PlmnIDNid{snpn}}}}
+	req := NewAccessTokenRequest()
+	req.NfInstanceID = "8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001"
+	req.Scope = "nudm-sdm"
+	req.TargetSnpn = snpn
+	if _, err := policy.Evaluate(req, "AMF", "UDM"); err == nil || err.Error != UnauthorizedClient {
+		t.Error("The consumer not in the SNPN should be rejected")
+	}
+	req.RequesterSnpnList = []*PlmnIDNid{&PlmnIDNid{Mcc: "460", Mnc: "00", Nid: "000007ED9D5"}}
+	if _, err := policy.Evaluate(req, "AMF", "UDM"); err != nil {
+		t.Error("The consumer in the SNPN should be allowed")
+	}
+	req.TargetSnpn = &PlmnIDNid{Mcc: "460", Mnc: "00", Nid: "000007ed9d6"}
+	if _, err := policy.Evaluate(req, "AMF", "UDM"); err == nil || err.Error != UnauthorizedClient {
+		t.Error("The target SNPN not in the rule should be rejected")
+	}
+}
+
+func TestAuthorizationPolicyNarrowScope(t *testing.T) {
+	policy := createTestPolicy()
+	policy.Rules[1].AllowedServices = []string{"nudm-sdm:am-data", "nudm-uecm"}
+	req := NewAccessTokenRequest()
+	req.NfInstanceID = "1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001"
+	req.Scope = "namf-comm namf-evts namf-loc:location:read"
+	scope, err := policy.Evaluate(req, "LMF", "AMF")
+	if err != nil || scope != "namf-comm namf-loc:location:read" {
+		t.Fail()
+	}
+
+	req.NfInstanceID = "8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001"
+	req.RequesterPlmnList = []*PlmnID{&PlmnID{Mcc: "460", Mnc: "00"}}
+	req.TargetSnssaiList = []*Snssai{&Snssai{Sst: 1}}
+	req.Scope = "nudm-sdm nudm-sdm:am-data:read nudm-sdm:sm-data"
+	scope, err = policy.Evaluate(req, "AMF", "UDM")
+	if err != nil || scope != "nudm-sdm:am-data:read" {
+		t.Fail()
+	}
+}
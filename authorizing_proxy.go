@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+// the error codes of the protected resource defined in RFC 6750
+const (
+	InvalidToken      string = "invalid_token"
+	InsufficientScope string = "insufficient_scope"
+)
+
+// ScopeMapping the scope required by the requests in the path prefix
+type ScopeMapping struct {
+	PathPrefix string `yaml:"pathPrefix"`
+	Scope      string `yaml:"scope"`
+}
+
+// AuthorizingProxy a reverse proxy in front of the SBI of a NF service producer.
+// The request is forwarded to the producer only if its bearer token is valid
+// and grants the scope required by the request path
+type AuthorizingProxy struct {
+	router       *gin.Engine
+	verifier     *AccessTokenVerifier
+	reverseProxy *httputil.ReverseProxy
+	// the scopes required by the path prefixes, the longest prefix is matched
+	scopeMappings []*ScopeMapping
+	// the header contains the client certificate forwarded by the TLS terminator
+	clientCertHeader *ClientCertHeader
+	// true to accept the h2c requests
+	http2       bool
+	tlsCertFile string
+	tlsKeyFile  string
+	// the CA certificates to verify the client certificate, mTLS is enabled if it is set
+	clientCAFile string
+}
+
+// NewAuthorizingProxy create a AuthorizingProxy which forwards the authorized
+// requests to the upstreamURL of the producer over HTTP/1.1, or HTTP/2 if
+// http2Upstream is true. The token is verified by the verifier
+func NewAuthorizingProxy(upstreamURL string, http2Upstream bool, tlsConfig *tls.Config, verifier *AccessTokenVerifier) (*AuthorizingProxy, error) {
+	u, err := url.Parse(upstreamURL)
+	if err != nil {
+		return nil, err
+	}
+	if len(u.Scheme) <= 0 || len(u.Host) <= 0 {
+		return nil, fmt.Errorf("Invalid upstream URL %s", upstreamURL)
+	}
+	if u.Scheme == "http" {
+		tlsConfig = nil
+	}
+	reverseProxy := httputil.NewSingleHostReverseProxy(u)
+	reverseProxy.Transport = createTransport(http2Upstream, tlsConfig)
+	reverseProxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		log.Error("Fail to forward ", r.URL.Path, " to ", upstreamURL, " with error:", err)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	router := gin.New()
+	proxy := &AuthorizingProxy{router: router,
+		verifier:      verifier,
+		reverseProxy:  reverseProxy,
+		scopeMappings: make([]*ScopeMapping, 0)}
+	router.NoRoute(proxy.HandleRequest)
+	return proxy, nil
+}
+
+// AddScopeMapping require the scope for the requests in the pathPrefix, for
+// example "namf-comm:ue-contexts" for "/namf-comm/v1/ue-contexts". The scope
+// is the service name in the first path segment if no path prefix is matched
+func (ap *AuthorizingProxy) AddScopeMapping(pathPrefix string, scope string) {
+	ap.scopeMappings = append(ap.scopeMappings, &ScopeMapping{PathPrefix: pathPrefix, Scope: scope})
+}
+
+// SetClientCertHeader set the header which contains the client certificate
+// forwarded by the trusted TLS terminator. The certificate is used to verify
+// the certificate bound token if the request is not over mTLS
+func (ap *AuthorizingProxy) SetClientCertHeader(header *ClientCertHeader) {
+	ap.clientCertHeader = header
+}
+
+// SetTLS accept the requests over TLS with the certificate and key files
+func (ap *AuthorizingProxy) SetTLS(tlsCertFile string, tlsKeyFile string) {
+	ap.tlsCertFile = tlsCertFile
+	ap.tlsKeyFile = tlsKeyFile
+}
+
+// SetClientCA require the client certificate signed by the CA in the
+// clientCAFile if TLS is enabled, the certificate bound token is verified
+// with it
+func (ap *AuthorizingProxy) SetClientCA(clientCAFile string) {
+	ap.clientCAFile = clientCAFile
+}
+
+// EnableHTTP2 accept the HTTP/2 requests with prior knowledge(h2c)
+func (ap *AuthorizingProxy) EnableHTTP2() {
+	ap.http2 = true
+}
+
+// GetRequiredScope get the scope required by the request path, empty if the
+// scope is unknown
+func (ap *AuthorizingProxy) GetRequiredScope(path string) string {
+	var mapping *ScopeMapping
+	for _, m := range ap.scopeMappings {
+		if strings.HasPrefix(path, m.PathPrefix) && (mapping == nil || len(m.PathPrefix) > len(mapping.PathPrefix)) {
+			mapping = m
+		}
+	}
+	if mapping != nil {
+		return mapping.Scope
+	}
+	segments := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)
+	if IsValidServiceName(segments[0]) {
+		return segments[0]
+	}
+	return ""
+}
+
+// HandleRequest verify the bearer token of the request and forward the
+// authorized request to the producer. The unauthorized request is replied
+// with 401 or 403 and the WWW-Authenticate header defined in RFC 6750
+func (ap *AuthorizingProxy) HandleRequest(c *gin.Context) {
+	auth := c.GetHeader("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		log.Error("No bearer token in request ", c.Request.URL.Path)
+		c.Header("WWW-Authenticate", "Bearer")
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+	if !isNormalizedPath(c.Request.URL) {
+		log.Error("Reject request with dot segments or encoded separators ", c.Request.URL.EscapedPath())
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	scope := ap.GetRequiredScope(c.Request.URL.Path)
+	if len(scope) <= 0 {
+		log.Error("No scope is mapped to request ", c.Request.URL.Path)
+		ap.replyError(c, http.StatusForbidden, InsufficientScope, "no scope is mapped to the path", "")
+		return
+	}
+	cert, err := ap.getClientCertificate(c)
+	if err != nil {
+		log.Error("Fail to get the client certificate with error:", err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	claims, err := ap.verifier.VerifyTokenWithCertificate([]byte(strings.TrimSpace(auth[len("Bearer "):])), cert)
+	if err == nil {
+		err = (&VerificationOptions{Scope: scope}).Validate(claims)
+	}
+	if err != nil {
+		log.Error("Reject request ", c.Request.URL.Path, " with error:", err)
+		var claimErr *ClaimError
+		if errors.As(err, &claimErr) && claimErr.Claim == "scope" {
+			ap.replyError(c, http.StatusForbidden, InsufficientScope, err.Error(), scope)
+		} else {
+			ap.replyError(c, http.StatusUnauthorized, InvalidToken, err.Error(), "")
+		}
+		return
+	}
+	ap.reverseProxy.ServeHTTP(c.Writer, c.Request)
+}
+
+// isNormalizedPath return true if the path has no dot segment and no encoded
+// path separator, so the scope is checked against the same resource as the
+// producer resolves from the forwarded path
+func isNormalizedPath(u *url.URL) bool {
+	escapedPath := strings.ToLower(u.EscapedPath())
+	if strings.Contains(escapedPath, "%2f") || strings.Contains(escapedPath, "%5c") || strings.Contains(u.Path, "\\") {
+		return false
+	}
+	for _, segment := range strings.Split(u.Path, "/") {
+		if segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+func (ap *AuthorizingProxy) getClientCertificate(c *gin.Context) (*x509.Certificate, error) {
+	if c.Request.TLS != nil && len(c.Request.TLS.PeerCertificates) > 0 {
+		return c.Request.TLS.PeerCertificates[0], nil
+	}
+	if ap.clientCertHeader != nil {
+		return ap.clientCertHeader.GetCertificate(c.Request)
+	}
+	return nil, nil
+}
+
+func (ap *AuthorizingProxy) replyError(c *gin.Context, status int, code string, description string, scope string) {
+	description = strings.Replace(description, `"`, "'", -1)
+	value := fmt.Sprintf(`Bearer error="%s", error_description="%s"`, code, description)
+	if len(scope) > 0 {
+		value += fmt.Sprintf(`, scope="%s"`, scope)
+	}
+	c.Header("WWW-Authenticate", value)
+	c.JSON(status, &AccessTokenError{Error: code, ErrorDescription: description})
+}
+
+// Start start the authorizing proxy in the address
+func (ap *AuthorizingProxy) Start(addr string) error {
+	log.Info("start authorizing proxy in ", addr)
+	return listenAndServe(addr, ap.router, ap.http2, ap.tlsCertFile, ap.tlsKeyFile, ap.clientCAFile)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"github.com/lestrrat-go/jwx/jwa"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func createAuthorizingProxy(t *testing.T, upstreamURL string, http2Upstream bool) (*AuthorizingProxy, string) {
+	key, _ := loadSignatureKey([]byte(privateKey))
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	token, err := createTokenWithServer(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey, _ := loadSignatureKey([]byte(publicKey))
+	proxy := NewProxy("/reqtoken", "/verify", "http://127.0.0.1:1", nil, false, jwa.RS256, NewStaticKeySource(pubKey))
+	authorizingProxy, err := proxy.CreateAuthorizingProxy(upstreamURL, http2Upstream, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authorizingProxy, token
+}
+
+// sendWithToken send the request to the server because the reverse proxy
+// requires the http.CloseNotifier which is not implemented by httptest.ResponseRecorder
+func sendWithToken(server *httptest.Server, path string, token string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return w
+	}
+	defer resp.Body.Close()
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+	return w
+}
+
+func TestAuthorizingProxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer upstream.Close()
+	authorizingProxy, token := createAuthorizingProxy(t, upstream.URL, false)
+	authorizingProxy.AddScopeMapping("/namf-comm/v1/subscriptions", "namf-comm:subscriptions")
+	authorizingProxy.AddScopeMapping("/namf-comm/v1/subscriptions/admin", "namf-evts")
+	ts := httptest.NewServer(authorizingProxy.router)
+	defer ts.Close()
+
+	w := sendWithToken(ts, "/namf-comm/v1/ue-contexts/imsi-1", token)
+	if w.Code != http.StatusOK || w.Body.String() != "/namf-comm/v1/ue-contexts/imsi-1" {
+		t.Error("The authorized request should be forwarded ", w.Code, w.Body.String())
+	}
+	if w = sendWithToken(ts, "/namf-comm/v1/subscriptions", token); w.Code != http.StatusOK {
+		t.Error("The resource-level scope should be covered by the service scope")
+	}
+
+	w = sendWithToken(ts, "/namf-comm/v1/ue-contexts", "")
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != "Bearer" {
+		t.Error("The request without token should be rejected with 401")
+	}
+	w = sendWithToken(ts, "/namf-comm/v1/ue-contexts", token+"x")
+	if w.Code != http.StatusUnauthorized || !strings.HasPrefix(w.Header().Get("WWW-Authenticate"), `Bearer error="invalid_token"`) {
+		t.Error("The request with invalid token should be rejected with 401 ", w.Header().Get("WWW-Authenticate"))
+	}
+	w = sendWithToken(ts, "/namf-comm/v1/subscriptions/admin", token)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Header().Get("WWW-Authenticate"), `scope="namf-evts"`) {
+		t.Error("The request with insufficient scope should be rejected with 403 ", w.Header().Get("WWW-Authenticate"))
+	}
+	if w = sendWithToken(ts, "/nsmf-pdusession/v1/sm-contexts", token); w.Code != http.StatusForbidden {
+		t.Error("The request to other service should be rejected with 403")
+	}
+	if w = sendWithToken(ts, "/unknown/v1", token); w.Code != http.StatusForbidden {
+		t.Error("The request without mapped scope should be rejected with 403")
+	}
+	for _, path := range []string{"/namf-comm/../nudm-sdm/v2/imsi-1/am-data",
+		"/namf-comm/v1/%2e%2e/%2e%2e/nudm-sdm/v2/imsi-1/am-data",
+		"/namf-comm%2F..%2Fnudm-sdm/v2/imsi-1/am-data",
+		"/namf-comm/./v1/ue-contexts"} {
+		if w = sendWithToken(ts, path, token); w.Code != http.StatusBadRequest {
+			t.Error("The request with dot segments or encoded separators should be rejected ", path, " ", w.Code, " ", w.Body.String())
+		}
+	}
+}
+
+func TestAuthorizingProxyH2C(t *testing.T) {
+	upstream := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Proto)
+	}), &http2.Server{}))
+	defer upstream.Close()
+	authorizingProxy, token := createAuthorizingProxy(t, upstream.URL, true)
+	ts := httptest.NewServer(authorizingProxy.router)
+	defer ts.Close()
+
+	w := sendWithToken(ts, "/namf-comm/v1/ue-contexts", token)
+	if w.Code != http.StatusOK || w.Body.String() != "HTTP/2.0" {
+		t.Error("The request should be forwarded over h2c ", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GetCertificateNfInstanceIDs get the NF instance ids from the URI
+// subject alternative names in "urn:uuid:<nfInstanceId>" format
+func GetCertificateNfInstanceIDs(cert *x509.Certificate) []string {
+	result := make([]string, 0)
+	for _, uri := range cert.URIs {
+		if strings.EqualFold(uri.Scheme, "urn") && strings.HasPrefix(strings.ToLower(uri.Opaque), "uuid:") {
+			result = append(result, strings.ToLower(uri.Opaque[len("uuid:"):]))
+		}
+	}
+	return result
+}
+
+// IsCertificateForNfInstance return true if the certificate has the nfInstanceID
+// in its URI subject alternative names
+func IsCertificateForNfInstance(cert *x509.Certificate, nfInstanceID string) bool {
+	for _, id := range GetCertificateNfInstanceIDs(cert) {
+		if id == strings.ToLower(nfInstanceID) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsCertificateForFqdn return true if the certificate has the fqdn in its
+// DNS subject alternative names
+func IsCertificateForFqdn(cert *x509.Certificate, fqdn string) bool {
+	fqdn = strings.TrimSuffix(fqdn, ".")
+	for _, name := range cert.DNSNames {
+		if strings.EqualFold(strings.TrimSuffix(name, "."), fqdn) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetCertificateThumbprint get the base64url-encoded SHA-256 thumbprint of the
+// DER encoding certificate, the "x5t#S256" defined in RFC 8705
+func GetCertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ParseCertificateHeader parse the client certificate forwarded by the TLS
+// terminator in a HTTP header. The certificate can be in:
+// - PEM format, optionally URL-encoded(e.g. the $ssl_client_escaped_cert of nginx)
+// - base64-encoded DER format
+func ParseCertificateHeader(value string) (*x509.Certificate, error) {
+	value = strings.TrimSpace(value)
+	if strings.Contains(value, "%") {
+		unescaped, err := url.PathUnescape(value)
+		if err != nil {
+			return nil, err
+		}
+		value = unescaped
+	}
+	if strings.Contains(value, "-----BEGIN") {
+		p, _ := pem.Decode([]byte(value))
+		if p == nil {
+			return nil, fmt.Errorf("not in PEM format")
+		}
+		return x509.ParseCertificate(p.Bytes)
+	}
+	b, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(b)
+}
+
+// ClientCertHeader the HTTP header which contains the client certificate
+// forwarded by the TLS terminator. Anyone can put a certificate in the header,
+// so it is accepted only from the trusted TLS terminators
+type ClientCertHeader struct {
+	name string
+	// the addresses of the trusted TLS terminators
+	trustedSources []*net.IPNet
+}
+
+// NewClientCertHeader create a ClientCertHeader with the header name and the
+// IP addresses or CIDRs of the trusted TLS terminators
+func NewClientCertHeader(name string, trustedSources []string) (*ClientCertHeader, error) {
+	if len(trustedSources) <= 0 {
+		return nil, fmt.Errorf("No trusted source of the client certificate header %s", name)
+	}
+	header := &ClientCertHeader{name: name, trustedSources: make([]*net.IPNet, 0)}
+	for _, source := range trustedSources {
+		if !strings.Contains(source, "/") {
+			if ip := net.ParseIP(source); ip != nil && ip.To4() != nil {
+				source += "/32"
+			} else {
+				source += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(source)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid trusted source %s of the client certificate header", source)
+		}
+		header.trustedSources = append(header.trustedSources, ipNet)
+	}
+	return header, nil
+}
+
+// IsTrustedSource return true if the request is sent by a trusted TLS terminator
+func (h *ClientCertHeader) IsTrustedSource(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range h.trustedSources {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetCertificate get the client certificate in the header of the request from
+// a trusted TLS terminator. Return nil if the header is not present or the
+// request is not from a trusted TLS terminator
+func (h *ClientCertHeader) GetCertificate(r *http.Request) (*x509.Certificate, error) {
+	value := r.Header.Get(h.name)
+	if len(value) <= 0 {
+		return nil, nil
+	}
+	if !h.IsTrustedSource(r) {
+		log.Warn("Ignore the client certificate header ", h.name, " from the untrusted source ", r.RemoteAddr)
+		return nil, nil
+	}
+	return ParseCertificateHeader(value)
+}
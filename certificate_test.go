@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func createTestCertificate(uris []string, dnsNames []string) (*x509.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1),
+		Subject:   pkix.Name{CommonName: "test"},
+		NotBefore: time.Now(),
+		NotAfter:  time.Now().Add(time.Hour),
+		DNSNames:  dnsNames}
+	for _, s := range uris {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		template.URIs = append(template.URIs, u)
+	}
+	b, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(b)
+}
+
+func TestCertificateIdentity(t *testing.T) {
+	cert, err := createTestCertificate([]string{"urn:uuid:974EAF3A-175E-11EB-BF74-BB1F819F224D"}, []string{"lmf.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsCertificateForNfInstance(cert, "974eaf3a-175e-11eb-bf74-bb1f819f224d") || IsCertificateForNfInstance(cert, "1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001") {
+		t.Fail()
+	}
+	if !IsCertificateForFqdn(cert, "lmf.example.com.") || IsCertificateForFqdn(cert, "amf.example.com") {
+		t.Fail()
+	}
+	if len(GetCertificateThumbprint(cert)) != 43 {
+		t.Fail()
+	}
+
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, nil)
+	req := NewAccessTokenRequest()
+	req.NfInstanceID = "974eaf3a-175e-11eb-bf74-bb1f819f224d"
+	if server.checkCertificateIdentity(cert, req) != nil {
+		t.Fail()
+	}
+	req.RequesterFqdn = "amf.example.com"
+	if server.checkCertificateIdentity(cert, req) == nil {
+		t.Fail()
+	}
+	req.RequesterFqdn = ""
+	req.NfInstanceID = "1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001"
+	if server.checkCertificateIdentity(cert, req) == nil {
+		t.Fail()
+	}
+
+	cert, err = createTestCertificate(nil, []string{"lmf.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.checkCertificateIdentity(cert, req) == nil {
+		t.Fail()
+	}
+	// the requesterFqdn matches the certificate but the nfInstanceId is not registered
+	req.RequesterFqdn = "lmf.example.com"
+	if server.checkCertificateIdentity(cert, req) == nil {
+		t.Error("The nfInstanceId should not be identified by the requesterFqdn without NF profile")
+	}
+	store := NewNFProfileStore()
+	store.AddProfile(&NFProfile{NfInstanceID: "1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001", NfType: "LMF", Fqdn: "lmf.example.com"})
+	store.AddProfile(&NFProfile{NfInstanceID: "5a7bd676-ceeb-44bb-95e0-f6a55a312345", NfType: "AMF", Fqdn: "amf.example.com"})
+	server.SetNFProfileStore(store)
+	if server.checkCertificateIdentity(cert, req) != nil {
+		t.Fail()
+	}
+	// the holder of the LMF certificate impersonates the AMF
+	req.NfInstanceID = "5a7bd676-ceeb-44bb-95e0-f6a55a312345"
+	if server.checkCertificateIdentity(cert, req) == nil {
+		t.Error("The NF instance with other FQDN should not be impersonated")
+	}
+	req.NfInstanceID = "8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001"
+	if server.checkCertificateIdentity(cert, req) == nil {
+		t.Error("The unregistered NF instance should not be identified by the requesterFqdn")
+	}
+}
+
+func TestCertificateBoundToken(t *testing.T) {
+	key, err := loadSignatureKey([]byte(privateKey))
+	if err != nil {
+		t.Fail()
+	}
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	req := NewAccessTokenRequest()
+	req.GrantType = "client_credentials"
+	req.NfInstanceID = "1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001"
+	req.NfType = "LMF"
+	req.TargetNfType = "AMF"
+	req.Scope = "namf-comm"
+	unbound, _ := server.createToken(req)
+	bound, accessTokenErr := server.createBoundToken(req, "thumbprint-1")
+	if accessTokenErr != nil || bound == unbound {
+		t.Fail()
+	}
+	token, err := jwt.ParseBytes([]byte(bound))
+	if err != nil {
+		t.Fail()
+	}
+	atc := NewAccessTokenClaims()
+	if atc.FromJwtToken(token) != nil || atc.Cnf == nil || atc.Cnf.X5tS256 != "thumbprint-1" {
+		t.Fail()
+	}
+}
+
+func TestVerifyCertificateBoundToken(t *testing.T) {
+	privKey, err := loadSignatureKey([]byte(privateKey))
+	if err != nil {
+		t.Fail()
+	}
+	pubKey, err := loadSignatureKey([]byte(publicKey))
+	if err != nil {
+		t.Fail()
+	}
+	cert, err := createTestCertificate([]string{"urn:uuid:974eaf3a-175e-11eb-bf74-bb1f819f224d"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherCert, err := createTestCertificate(nil, []string{"lmf.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, privKey)
+	req := NewAccessTokenRequest()
+	req.GrantType = "client_credentials"
+	req.NfInstanceID = "974eaf3a-175e-11eb-bf74-bb1f819f224d"
+	req.NfType = "LMF"
+	req.TargetNfType = "AMF"
+	req.Scope = "namf-comm"
+	token, _ := server.createBoundToken(req, GetCertificateThumbprint(cert))
+
+	verifier := NewAccessTokenVerifier(jwa.RS256, pubKey)
+	if _, err = verifier.VerifyTokenWithCertificate([]byte(token), cert); err != nil {
+		t.Error(err)
+	}
+	if _, err = verifier.VerifyTokenWithCertificate([]byte(token), otherCert); err == nil {
+		t.Fail()
+	}
+	if _, err = verifier.VerifyTokenWithCertificate([]byte(token), nil); err == nil {
+		t.Fail()
+	}
+}
+
+func TestParseCertificateHeader(t *testing.T) {
+	cert, err := createTestCertificate(nil, []string{"lmf.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+	for _, value := range []string{pemCert, url.PathEscape(pemCert), base64.StdEncoding.EncodeToString(cert.Raw)} {
+		parsed, err := ParseCertificateHeader(value)
+		if err != nil || !parsed.Equal(cert) {
+			t.Errorf("Fail to parse %s", value)
+		}
+	}
+}
+
+func TestClientCertHeaderTrustedSource(t *testing.T) {
+	if _, err := NewClientCertHeader("X-Client-Cert", nil); err == nil {
+		t.Error("The client certificate header without trusted source should be rejected")
+	}
+	if _, err := NewClientCertHeader("X-Client-Cert", []string{"10.0.0.300"}); err == nil {
+		t.Error("The invalid trusted source should be rejected")
+	}
+	header, err := NewClientCertHeader("X-Client-Cert", []string{"10.0.0.0/8", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	privKey, _ := loadSignatureKey([]byte(privateKey))
+	pubKey, _ := loadSignatureKey([]byte(publicKey))
+	cert, _ := createTestCertificate([]string{"urn:uuid:974eaf3a-175e-11eb-bf74-bb1f819f224d"}, nil)
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, privKey)
+	req := NewAccessTokenRequest()
+	req.GrantType = "client_credentials"
+	req.NfInstanceID = "974eaf3a-175e-11eb-bf74-bb1f819f224d"
+	req.NfType = "LMF"
+	req.TargetNfType = "AMF"
+	req.Scope = "namf-comm"
+	token, _ := server.createBoundToken(req, GetCertificateThumbprint(cert))
+
+	proxy := NewProxy("/reqtoken", "/verify", "http://127.0.0.1:1", nil, false, jwa.RS256, NewStaticKeySource(pubKey))
+	proxy.SetClientCertHeader(header)
+	for remoteAddr, expected := range map[string]int{"10.1.2.3:5000": http.StatusOK,
+		"[::1]:5000":     http.StatusOK,
+		"192.0.2.1:5000": http.StatusBadRequest} {
+		r := httptest.NewRequest(http.MethodPost, "/verify", strings.NewReader(token))
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("X-Client-Cert", base64.StdEncoding.EncodeToString(cert.Raw))
+		w := httptest.NewRecorder()
+		proxy.router.ServeHTTP(w, r)
+		if w.Code != expected {
+			t.Errorf("Expect %d for the client certificate header from %s but get %d", expected, remoteAddr, w.Code)
+		}
+	}
+}
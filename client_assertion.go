@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jws"
+	"github.com/lestrrat-go/jwx/jwt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClientAssertionTypeJWTBearer the client_assertion_type of the client
+// credentials assertion defined in RFC 7523
+const ClientAssertionTypeJWTBearer string = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// DefaultClientAssertionMaxLifetime the default maximum lifetime of the CCA
+// accepted by the ClientAssertionVerifier
+const DefaultClientAssertionMaxLifetime = 5 * time.Minute
+
+// ClientAssertionSigner creates the client credentials assertion(CCA) defined
+// in TS 33.501 clause 13.3.8 on behalf of the NF service consumer. The CCA is
+// a JWT signed by the private key of the NF service consumer
+type ClientAssertionSigner struct {
+	alg jwa.SignatureAlgorithm
+	key interface{}
+	// the expected audience, the NF type of the NRF by default
+	audience []string
+	expire   time.Duration
+}
+
+// NewClientAssertionSigner create a ClientAssertionSigner with the signature
+// algorithm, the private key, the audience and the expire duration of the CCA
+func NewClientAssertionSigner(alg jwa.SignatureAlgorithm, key interface{}, audience []string, expire time.Duration) *ClientAssertionSigner {
+	if len(audience) <= 0 {
+		audience = []string{"NRF"}
+	}
+	return &ClientAssertionSigner{alg: alg,
+		key:      key,
+		audience: audience,
+		expire:   expire}
+}
+
+// Sign create a CCA for the NF service consumer with nfInstanceID
+func (cas *ClientAssertionSigner) Sign(nfInstanceID string) (string, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	token := jwt.New()
+	token.Set(jwt.IssuerKey, nfInstanceID)
+	token.Set(jwt.SubjectKey, nfInstanceID)
+	token.Set(jwt.AudienceKey, cas.audience)
+	token.Set(jwt.IssuedAtKey, now.Unix())
+	token.Set(jwt.ExpirationKey, now.Add(cas.expire).Unix())
+	token.Set(jwt.JwtIDKey, hex.EncodeToString(jti))
+	payload, err := jwt.Sign(token, cas.alg, cas.key)
+	if err != nil {
+		return "", err
+	}
+	return string(payload), nil
+}
+
+// ClientAssertionVerifier verifies the CCA sent by the NF service consumer and
+// rejects the replayed CCA by remembering the jti of the verified CCA
+type ClientAssertionVerifier struct {
+	sync.Mutex
+	// the accepted audience
+	audience []string
+	// the maximum lifetime of the CCA, a leaked CCA is usable and its jti
+	// is remembered only within it
+	maxLifetime int64
+	// the jti of the verified CCA and its expiration time
+	usedJtis map[string]int64
+}
+
+// NewClientAssertionVerifier create a ClientAssertionVerifier object which accepts
+// the CCA with one of the audience and the lifetime not longer than
+// DefaultClientAssertionMaxLifetime
+func NewClientAssertionVerifier(audience []string) *ClientAssertionVerifier {
+	return &ClientAssertionVerifier{audience: audience,
+		maxLifetime: int64(DefaultClientAssertionMaxLifetime.Seconds()),
+		usedJtis:    make(map[string]int64)}
+}
+
+// SetMaxLifetime set the maximum lifetime of the accepted CCA, from its iat to
+// its exp and from now to its exp
+func (cav *ClientAssertionVerifier) SetMaxLifetime(maxLifetime time.Duration) {
+	cav.maxLifetime = int64(maxLifetime.Seconds())
+}
+
+// Verify verify the CCA of the NF service consumer with nfInstanceID. The key is the
+// public key of the NF service consumer. Return error if:
+// - the signature of the CCA is not valid
+// - the sub or the iss is not the nfInstanceID
+// - the aud does not contain any accepted audience
+// - the CCA is expired or the iat or the jti is missing
+// - the lifetime of the CCA is longer than the maximum lifetime
+// - the CCA with same jti was already used
+func (cav *ClientAssertionVerifier) Verify(assertion string, nfInstanceID string, key interface{}) error {
+	msg, err := jws.Parse(strings.NewReader(assertion))
+	if err != nil {
+		return err
+	}
+	if len(msg.Signatures()) != 1 {
+		return fmt.Errorf("Only one signature is allowed in client assertion")
+	}
+	alg := msg.Signatures()[0].ProtectedHeaders().Algorithm()
+	if alg == jwa.NoSignature || strings.HasPrefix(alg.String(), "HS") {
+		return fmt.Errorf("Signature algorithm %s is not allowed in client assertion", alg)
+	}
+	token, err := jwt.Parse(bytes.NewBufferString(assertion), jwt.WithVerify(alg, key))
+	if err != nil {
+		return err
+	}
+	if token.Subject() != nfInstanceID || token.Issuer() != nfInstanceID {
+		return fmt.Errorf("The sub %s or iss %s of client assertion is not %s", token.Subject(), token.Issuer(), nfInstanceID)
+	}
+	if !cav.isAudienceAccepted(token.Audience()) {
+		return fmt.Errorf("The aud %v of client assertion is not accepted", token.Audience())
+	}
+	exp := token.Expiration().Unix()
+	now := time.Now().Unix()
+	if exp < now {
+		return fmt.Errorf("Expiration time %d of client assertion is less than current time %d", exp, now)
+	}
+	if token.IssuedAt().IsZero() {
+		return fmt.Errorf("Missing iat in client assertion")
+	}
+	iat := token.IssuedAt().Unix()
+	if exp-iat > cav.maxLifetime || exp-now > cav.maxLifetime {
+		return fmt.Errorf("The lifetime of client assertion from %d to %d is longer than %d seconds", iat, exp, cav.maxLifetime)
+	}
+	jti := token.JwtID()
+	if len(jti) <= 0 {
+		return fmt.Errorf("Missing jti in client assertion")
+	}
+	return cav.useJti(nfInstanceID+"/"+jti, exp)
+}
+
+func (cav *ClientAssertionVerifier) isAudienceAccepted(audience []string) bool {
+	for _, aud := range audience {
+		for _, accepted := range cav.audience {
+			if aud == accepted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (cav *ClientAssertionVerifier) useJti(jti string, exp int64) error {
+	cav.Lock()
+	defer cav.Unlock()
+
+	now := time.Now().Unix()
+	for k, v := range cav.usedJtis {
+		if v < now {
+			delete(cav.usedJtis, k)
+		}
+	}
+	if _, ok := cav.usedJtis[jti]; ok {
+		return fmt.Errorf("The client assertion with jti %s is replayed", jti)
+	}
+	cav.usedJtis[jti] = exp
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwt"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientAssertionSignAndVerify(t *testing.T) {
+	privKey, err := loadSignatureKey([]byte(privateKey))
+	if err != nil {
+		t.Fail()
+	}
+	pubKey, err := loadSignatureKey([]byte(publicKey))
+	if err != nil {
+		t.Fail()
+	}
+	signer := NewClientAssertionSigner(jwa.RS256, privKey, nil, time.Duration(60)*time.Second)
+	assertion, err := signer.Sign("1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001")
+	if err != nil {
+		t.Fail()
+	}
+	verifier := NewClientAssertionVerifier([]string{"NRF"})
+	if err = verifier.Verify(assertion, "1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001", pubKey); err != nil {
+		t.Error(err)
+	}
+	// replayed
+	if verifier.Verify(assertion, "1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001", pubKey) == nil {
+		t.Fail()
+	}
+	assertion, _ = signer.Sign("1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001")
+	if verifier.Verify(assertion, "1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb002", pubKey) == nil {
+		t.Fail()
+	}
+	verifier = NewClientAssertionVerifier([]string{"instance-1"})
+	if verifier.Verify(assertion, "1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001", pubKey) == nil {
+		t.Fail()
+	}
+}
+
+func TestClientAssertionLifetime(t *testing.T) {
+	privKey, _ := loadSignatureKey([]byte(privateKey))
+	pubKey, _ := loadSignatureKey([]byte(publicKey))
+	verifier := NewClientAssertionVerifier([]string{"NRF"})
+	signer := NewClientAssertionSigner(jwa.RS256, privKey, nil, time.Duration(3600)*time.Second)
+	assertion, _ := signer.Sign("1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001")
+	if verifier.Verify(assertion, "1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001", pubKey) == nil {
+		t.Error("The client assertion with a lifetime of one hour is accepted")
+	}
+	verifier.SetMaxLifetime(time.Duration(7200) * time.Second)
+	if err := verifier.Verify(assertion, "1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001", pubKey); err != nil {
+		t.Error(err)
+	}
+
+	// without iat
+	now := time.Now()
+	token := jwt.New()
+	token.Set(jwt.IssuerKey, "1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001")
+	token.Set(jwt.SubjectKey, "1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001")
+	token.Set(jwt.AudienceKey, []string{"NRF"})
+	token.Set(jwt.ExpirationKey, now.Add(time.Duration(60)*time.Second).Unix())
+	token.Set(jwt.JwtIDKey, "0123456789abcdef")
+	payload, _ := jwt.Sign(token, jwa.RS256, privKey)
+	if verifier.Verify(string(payload), "1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001", pubKey) == nil {
+		t.Error("The client assertion without iat is accepted")
+	}
+
+	// iat in the future
+	token.Set(jwt.IssuedAtKey, now.Add(time.Duration(7200)*time.Second).Unix())
+	token.Set(jwt.ExpirationKey, now.Add(time.Duration(7260)*time.Second).Unix())
+	payload, _ = jwt.Sign(token, jwa.RS256, privKey)
+	verifier.SetMaxLifetime(DefaultClientAssertionMaxLifetime)
+	if verifier.Verify(string(payload), "1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001", pubKey) == nil {
+		t.Error("The client assertion issued in the future is accepted")
+	}
+}
+
+func TestServerAuthenticateClient(t *testing.T) {
+	privKey, err := loadSignatureKey([]byte(privateKey))
+	if err != nil {
+		t.Fail()
+	}
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, privKey)
+	store := NewNFProfileStore()
+	store.AddProfile(&NFProfile{NfInstanceID: "1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001", NfType: "LMF", ClientPublicKey: publicKey})
+	server.SetNFProfileStore(store)
+	server.EnableClientAssertion(true, 0)
+
+	req := NewAccessTokenRequest()
+	req.NfInstanceID = "1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001"
+	if err := server.authenticateClient(req); err == nil || err.Error != InvalidClient {
+		t.Fail()
+	}
+	signer := NewClientAssertionSigner(jwa.RS256, privKey, nil, time.Duration(60)*time.Second)
+	req.ClientAssertion, _ = signer.Sign("1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001")
+	req.ClientAssertionType = ClientAssertionTypeJWTBearer
+	if server.authenticateClient(req) != nil {
+		t.Fail()
+	}
+}
+
+func TestProxySignClientAssertionForLocalNF(t *testing.T) {
+	privKey, _ := loadSignatureKey([]byte(privateKey))
+	pubKey, _ := loadSignatureKey([]byte(publicKey))
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, privKey)
+	store := NewNFProfileStore()
+	store.AddProfile(&NFProfile{NfInstanceID: "1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001", NfType: "LMF", ClientPublicKey: publicKey})
+	store.AddProfile(&NFProfile{NfInstanceID: "5a7bd676-ceeb-44bb-95e0-f6a55a312345", NfType: "LMF", ClientPublicKey: publicKey})
+	store.AddProfile(&NFProfile{NfInstanceID: "8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001", NfType: "AMF"})
+	server.SetNFProfileStore(store)
+	server.EnableClientAssertion(true, 0)
+	ts := httptest.NewServer(server.router)
+	defer ts.Close()
+
+	proxy := NewProxy("/reqtoken", "/verify", ts.URL+"/oauth2/token", nil, false, jwa.RS256, NewStaticKeySource(pubKey))
+	proxy.SetClientAssertionSigner("1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001", NewClientAssertionSigner(jwa.RS256, privKey, nil, time.Duration(60)*time.Second))
+	requestToken := func(nfInstanceID string) (*AccessTokenRequest, error) {
+		req := NewAccessTokenRequest()
+		req.GrantType = "client_credentials"
+		req.NfInstanceID = nfInstanceID
+		req.NfType = "LMF"
+		req.TargetNfType = "AMF"
+		req.Scope = "namf-comm"
+		_, err := proxy.RequestToken(req)
+		return req, err
+	}
+	if _, err := requestToken("1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001"); err != nil {
+		t.Error("The token should be granted to the local NF ", err)
+	}
+	req, err := requestToken("5a7bd676-ceeb-44bb-95e0-f6a55a312345")
+	if err == nil || len(req.ClientAssertion) > 0 {
+		t.Error("The client assertion should not be created for other NF instances")
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// the header of the apiRoot of the target producer defined in TS 29.500 clause 5.2.3.2.4
+const sbiTargetAPIRootHeader = "3gpp-Sbi-Target-apiRoot"
+
+// the hop-by-hop headers which are not forwarded, defined in RFC 7230 clause 6.1
+var hopByHopHeaders = []string{"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade"}
+
+// EgressProxy a forward proxy of the NF service consumer. The SBI request of
+// the consumer is forwarded to the producer with the access token for the
+// service in the request path
+type EgressProxy struct {
+	router *gin.Engine
+	// get the token from the local cache or the authorization server
+	proxy *Proxy
+	// the identity of the NF service consumer
+	nfInstanceID string
+	nfType       string
+	// the transports of the http and https producers
+	transports map[string]http.RoundTripper
+	// true to accept the h2c requests
+	http2       bool
+	tlsCertFile string
+	tlsKeyFile  string
+}
+
+// CreateEgressProxy create a EgressProxy for the NF service consumer with the
+// nfInstanceID and nfType. The requests are forwarded over HTTP/1.1, or HTTP/2
+// if http2Producer is true. The tlsConfig is used for the https producers
+func (p *Proxy) CreateEgressProxy(nfInstanceID string, nfType string, http2Producer bool, tlsConfig *tls.Config) *EgressProxy {
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	router := gin.New()
+	egressProxy := &EgressProxy{router: router,
+		proxy:        p,
+		nfInstanceID: nfInstanceID,
+		nfType:       nfType,
+		transports: map[string]http.RoundTripper{"http": createTransport(http2Producer, nil),
+			"https": createTransport(http2Producer, tlsConfig)}}
+	router.NoRoute(egressProxy.HandleRequest)
+	return egressProxy
+}
+
+// SetTLS accept the requests over TLS with the certificate and key files
+func (ep *EgressProxy) SetTLS(tlsCertFile string, tlsKeyFile string) {
+	ep.tlsCertFile = tlsCertFile
+	ep.tlsKeyFile = tlsKeyFile
+}
+
+// EnableHTTP2 accept the HTTP/2 requests with prior knowledge(h2c)
+func (ep *EgressProxy) EnableHTTP2() {
+	ep.http2 = true
+}
+
+// getTargetURL get the URL of the producer from the 3gpp-Sbi-Target-apiRoot
+// header, or the absolute URL of the request sent to a HTTP proxy
+func (ep *EgressProxy) getTargetURL(r *http.Request) (*url.URL, error) {
+	if apiRoot := r.Header.Get(sbiTargetAPIRootHeader); len(apiRoot) > 0 {
+		u, err := url.Parse(strings.TrimSuffix(apiRoot, "/") + r.URL.RequestURI())
+		if err != nil {
+			return nil, err
+		}
+		if len(u.Scheme) <= 0 || len(u.Host) <= 0 {
+			return nil, fmt.Errorf("Invalid %s %s", sbiTargetAPIRootHeader, apiRoot)
+		}
+		return u, nil
+	}
+	if r.URL.IsAbs() {
+		return r.URL, nil
+	}
+	return nil, fmt.Errorf("No %s header or absolute URL in the request", sbiTargetAPIRootHeader)
+}
+
+// createTokenRequest create the token request by NF type for the service in
+// the first path segment
+func (ep *EgressProxy) createTokenRequest(path string) (*AccessTokenRequest, error) {
+	serviceName := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)[0]
+	targetNfType := GetServiceNfType(serviceName)
+	if len(targetNfType) <= 0 {
+		return nil, fmt.Errorf("Unknown service %s in path %s", serviceName, path)
+	}
+	atr := NewAccessTokenRequest()
+	atr.GrantType = "client_credentials"
+	atr.NfInstanceID = ep.nfInstanceID
+	atr.NfType = ep.nfType
+	atr.TargetNfType = targetNfType
+	atr.Scope = serviceName
+	return atr, nil
+}
+
+// HandleRequest forward the request of the consumer to the producer with the
+// access token in the Authorization header. If the producer replies 401, the
+// token is removed from the cache and the request is retried once with a new token
+func (ep *EgressProxy) HandleRequest(c *gin.Context) {
+	targetURL, err := ep.getTargetURL(c.Request)
+	if err != nil {
+		log.Error(err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	transport, ok := ep.transports[targetURL.Scheme]
+	if !ok {
+		log.Error("Unsupported scheme in ", targetURL)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	atr, err := ep.createTokenRequest(targetURL.Path)
+	if err != nil {
+		log.Error(err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	// the body is kept to retry the request
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	var resp *http.Response
+	for retry := 0; retry < 2; retry++ {
+		var token *AccessTokenResponse
+		if retry > 0 {
+			// the rejected token may be still cached by the server
+			token, err = ep.proxy.RequestNewToken(atr)
+		} else {
+			token, err = ep.proxy.RequestToken(atr)
+		}
+		if err != nil {
+			log.Error("Fail to get token for ", atr.Scope, " with error:", err)
+			c.Status(http.StatusBadGateway)
+			return
+		}
+		resp, err = transport.RoundTrip(ep.createForwardRequest(c.Request, targetURL, body, token.AccessToken))
+		if err != nil {
+			log.Error("Fail to forward the request to ", targetURL, " with error:", err)
+			c.Status(http.StatusBadGateway)
+			return
+		}
+		if resp.StatusCode != http.StatusUnauthorized || retry > 0 {
+			break
+		}
+		log.Warn("The token for ", atr.Scope, " is rejected by ", targetURL.Host, ", retry with a new token")
+		resp.Body.Close()
+		ep.proxy.RemoveToken(atr)
+	}
+	defer resp.Body.Close()
+	copyHeaders(c.Writer.Header(), resp.Header)
+	c.Status(resp.StatusCode)
+	io.Copy(c.Writer, resp.Body)
+}
+
+func (ep *EgressProxy) createForwardRequest(r *http.Request, targetURL *url.URL, body []byte, token string) *http.Request {
+	req := r.Clone(r.Context())
+	req.URL = targetURL
+	req.Host = targetURL.Host
+	req.RequestURI = ""
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header = make(http.Header)
+	copyHeaders(req.Header, r.Header)
+	req.Header.Del(sbiTargetAPIRootHeader)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+// copyHeaders copy the headers except the hop-by-hop headers
+func copyHeaders(dst http.Header, src http.Header) {
+	for k, v := range src {
+		dst[k] = append([]string(nil), v...)
+	}
+	for _, h := range hopByHopHeaders {
+		dst.Del(h)
+	}
+}
+
+// Start start the egress proxy in the address
+func (ep *EgressProxy) Start(addr string) error {
+	log.Info("start egress proxy in ", addr)
+	return listenAndServe(addr, ep.router, ep.http2, ep.tlsCertFile, ep.tlsKeyFile, "")
+}
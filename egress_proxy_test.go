@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"github.com/lestrrat-go/jwx/jwa"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetServiceNfType(t *testing.T) {
+	for service, nfType := range map[string]string{"nudm-sdm": "UDM",
+		"namf-comm":     "AMF",
+		"n5g-eir-eica":  "5G_EIR",
+		"nsoraf-sor":    "SOR_AF",
+		"nnrf-disc":     "NRF",
+		"invalid":       "",
+		"Nudm-sdm":      "",
+		"nudm-sdm/v2/x": ""} {
+		if v := GetServiceNfType(service); v != nfType {
+			t.Errorf("Expect NF type %s of service %s but get %s", nfType, service, v)
+		}
+	}
+}
+
+func TestEgressProxy(t *testing.T) {
+	key, _ := loadSignatureKey([]byte(privateKey))
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	authServer := httptest.NewServer(server.router)
+	defer authServer.Close()
+
+	requests := 0
+	producer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// reject the first request to check the retry with a new token
+		if requests == 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Target-Api-Root", r.Header.Get(sbiTargetAPIRootHeader))
+		fmt.Fprintf(w, "%s %s %s", r.URL.RequestURI(), r.Header.Get("Authorization"), string(body))
+	}))
+	defer producer.Close()
+
+	pubKey, _ := loadSignatureKey([]byte(publicKey))
+	proxy := NewProxy("/reqtoken", "/verify", authServer.URL+"/oauth2/token", nil, false, jwa.RS256, NewStaticKeySource(pubKey))
+	egressProxy := proxy.CreateEgressProxy("8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001", "AMF", false, nil)
+	ts := httptest.NewServer(egressProxy.router)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/nudm-sdm/v2/imsi-1/am-data?plmn-id=1", strings.NewReader("data"))
+	req.Header.Set(sbiTargetAPIRootHeader, producer.URL)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || requests != 2 {
+		t.Fatal("The request should be retried once after 401 ", resp.StatusCode, requests)
+	}
+	if len(resp.Header.Get("X-Target-Api-Root")) > 0 {
+		t.Error("The 3gpp-Sbi-Target-apiRoot header should not be forwarded")
+	}
+	fields := strings.Split(string(b), " ")
+	if len(fields) != 4 || fields[0] != "/nudm-sdm/v2/imsi-1/am-data?plmn-id=1" || fields[1] != "Bearer" || fields[3] != "data" {
+		t.Fatal("Unexpected forwarded request ", string(b))
+	}
+	claims, err := proxy.verifier.VerifyTokenClaims([]byte(fields[2]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Sub != "8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001" || claims.Scope != "nudm-sdm" || len(claims.Aud) != 1 || claims.Aud[0] != "UDM" {
+		t.Error("Unexpected claims of the injected token ", claims.Sub, claims.Scope, claims.Aud)
+	}
+
+	// the token is got from the local cache
+	req, _ = http.NewRequest(http.MethodGet, ts.URL+"/nudm-sdm/v2/imsi-1", nil)
+	req.Header.Set(sbiTargetAPIRootHeader, producer.URL)
+	if resp, err = http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatal("The request should be forwarded with the cached token ", err)
+	}
+	resp.Body.Close()
+
+	for _, path := range []string{"/unknown/v1", "/"} {
+		req, _ = http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		req.Header.Set(sbiTargetAPIRootHeader, producer.URL)
+		if resp, err = http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusBadRequest {
+			t.Error("The request to unknown service should be rejected ", path)
+		}
+		resp.Body.Close()
+	}
+	if resp, err = http.Get(ts.URL + "/nudm-sdm/v2/imsi-1"); err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Error("The request without target should be rejected")
+	}
+	resp.Body.Close()
+}
+
+func TestEgressProxyRetryWithClientAssertion(t *testing.T) {
+	key, _ := loadSignatureKey([]byte(privateKey))
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	store := NewNFProfileStore()
+	store.AddProfile(&NFProfile{NfInstanceID: "8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001", NfType: "AMF", ClientPublicKey: publicKey})
+	store.AddProfile(&NFProfile{NfInstanceID: "7e8f9a0b-1c2d-4e3f-8a4b-5c6d7e8fd001", NfType: "UDM"})
+	server.SetNFProfileStore(store)
+	server.EnableClientAssertion(true, 0)
+	authServer := httptest.NewServer(server.router)
+	defer authServer.Close()
+
+	requests := 0
+	tokens := make([]string, 0)
+	producer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		tokens = append(tokens, r.Header.Get("Authorization"))
+		if requests == 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer producer.Close()
+
+	pubKey, _ := loadSignatureKey([]byte(publicKey))
+	proxy := NewProxy("/reqtoken", "/verify", authServer.URL+"/oauth2/token", nil, false, jwa.RS256, NewStaticKeySource(pubKey))
+	proxy.SetClientAssertionSigner("8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001", NewClientAssertionSigner(jwa.RS256, key, nil, time.Duration(60)*time.Second))
+	egressProxy := proxy.CreateEgressProxy("8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001", "AMF", false, nil)
+	ts := httptest.NewServer(egressProxy.router)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/nudm-sdm/v2/imsi-1/am-data", nil)
+	req.Header.Set(sbiTargetAPIRootHeader, producer.URL)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || requests != 2 {
+		t.Fatal("The request should be retried with the token requested by a new client assertion ", resp.StatusCode, requests)
+	}
+	if tokens[0] == tokens[1] {
+		t.Error("The rejected token cached by the server should not be used in the retry")
+	}
+}
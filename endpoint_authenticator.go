@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// EndpointAuthenticator authenticates the caller of the introspection,
+// revocation and administration endpoints with HTTP Basic authentication or the verified client
+// certificate
+type EndpointAuthenticator struct {
+	// the client id and the secret of the Basic authentication
+	credentials map[string]string
+	// true to accept the caller with verified client certificate
+	allowClientCert bool
+	// accept only the client certificate for one of the FQDNs if it is not empty
+	certFqdns []string
+}
+
+// NewEndpointAuthenticator create a EndpointAuthenticator with the
+// Basic authentication credentials. If allowClientCert is true, the caller with
+// a client certificate verified by mTLS is also accepted
+func NewEndpointAuthenticator(credentials map[string]string, allowClientCert bool) *EndpointAuthenticator {
+	if credentials == nil {
+		credentials = make(map[string]string)
+	}
+	return &EndpointAuthenticator{credentials: credentials, allowClientCert: allowClientCert}
+}
+
+// SetCertificateFqdns accept only the verified client certificate issued for
+// one of the fqdns
+func (ia *EndpointAuthenticator) SetCertificateFqdns(fqdns []string) {
+	ia.certFqdns = fqdns
+}
+
+// IsConfigured return true if any client authentication method is configured,
+// otherwise all the callers are rejected
+func (ia *EndpointAuthenticator) IsConfigured() bool {
+	return len(ia.credentials) > 0 || ia.allowClientCert
+}
+
+// Authenticate return true if the caller is authenticated
+func (ia *EndpointAuthenticator) Authenticate(r *http.Request) bool {
+	if clientID, secret, ok := r.BasicAuth(); ok {
+		expected, found := ia.credentials[clientID]
+		return found && subtle.ConstantTimeCompare([]byte(secret), []byte(expected)) == 1
+	}
+	if !ia.allowClientCert || r.TLS == nil || len(r.TLS.VerifiedChains) <= 0 {
+		return false
+	}
+	if len(ia.certFqdns) <= 0 {
+		return true
+	}
+	for _, fqdn := range ia.certFqdns {
+		if IsCertificateForFqdn(r.TLS.PeerCertificates[0], fqdn) {
+			return true
+		}
+	}
+	return false
+}
+
+// getAuthMethods get the client authentication methods published in the
+// authorization server metadata
+func (ia *EndpointAuthenticator) getAuthMethods() []string {
+	methods := make([]string, 0)
+	if len(ia.credentials) > 0 {
+		methods = append(methods, "client_secret_basic")
+	}
+	if ia.allowClientCert {
+		methods = append(methods, "tls_client_auth")
+	}
+	return methods
+}
+
+// authenticateEndpoint authenticate the caller of the endpoint and reply
+// 401 with the realm if the caller is not authenticated
+func authenticateEndpoint(c *gin.Context, authenticator *EndpointAuthenticator, realm string) bool {
+	if authenticator.Authenticate(c.Request) {
+		return true
+	}
+	c.Header("WWW-Authenticate", `Basic realm="`+realm+`"`)
+	c.JSON(http.StatusUnauthorized, NewAccessTokenError(InvalidClient))
+	return false
+}
@@ -3,10 +3,11 @@ module github.com/ochinchina/oauth5g
 go 1.15
 
 require (
-	github.com/ajg/form v1.5.1
 	github.com/gin-gonic/gin v1.6.3
 	github.com/labstack/echo/v4 v4.1.17
-	github.com/lestrrat-go/jwx v1.0.5
+	github.com/lestrrat-go/jwx v1.0.8
+	github.com/lestrrat-go/pdebug v0.0.0-20200204225717-4d6bd78da58d // indirect
+	github.com/miekg/pkcs11 v1.1.1
 	github.com/sirupsen/logrus v1.7.0
 	github.com/urfave/cli/v2 v2.2.0
 	golang.org/x/net v0.0.0-20200822124328-c89045814202
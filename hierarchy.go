@@ -0,0 +1,68 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+// SetParentServer delegate the token requests which can't be served locally
+// to the parent authorization server by the client, for example from the
+// local NRF to the PLMN-level NRF
+func (s *OAuthServer) SetParentServer(client *OAuthClient) {
+	s.parentClient = client
+}
+
+// SetSnssaiList set the S-NSSAIs served by the authorization server. The
+// token request for other S-NSSAIs is delegated to the parent server
+func (s *OAuthServer) SetSnssaiList(snssaiList []*Snssai) {
+	s.snssaiList = snssaiList
+}
+
+// canServeLocally return true if the target NF service producer is
+// registered in this server and all the target S-NSSAIs are served
+func (s *OAuthServer) canServeLocally(art *AccessTokenRequest) bool {
+	if len(s.snssaiList) > 0 {
+		for _, snssai := range art.TargetSnssaiList {
+			if !containsSnssai(s.snssaiList, snssai) {
+				return false
+			}
+		}
+	}
+	if s.nfProfileStore == nil {
+		return true
+	}
+	if art.IsRequestByInstance() {
+		_, ok := s.nfProfileStore.GetProfile(art.TargetNfInstanceID)
+		return ok
+	}
+	return len(s.nfProfileStore.GetProfilesByNfType(art.TargetNfType)) > 0
+}
+
+// delegateTokenRequest reply the token got from the parent server, the
+// granted token is cached with its granted scope until it is near to expire.
+// The parent trusts the consumer authenticated by this server, so the request
+// is checked locally before it is delegated
+func (s *OAuthServer) delegateTokenRequest(c *gin.Context, art *AccessTokenRequest, b []byte, peerPlmnConsumer bool, noCache bool) {
+	if accessTokenErr := s.checkForwardedRequest(art, peerPlmnConsumer); accessTokenErr != nil {
+		c.JSON(http.StatusBadRequest, accessTokenErr)
+		return
+	}
+	key, cacheable := s.getTokenCacheKey(art, "")
+	key = "parent#" + key
+	if cacheable && !noCache {
+		if t, expireTime, scope, err := s.tokenCache.GetGrantedToken(key); err == nil {
+			replyTokenResponse(c, &AccessTokenResponse{AccessToken: t,
+				TokenType: "Bearer",
+				ExpiresIn: getExpiresIn(expireTime),
+				Scope:     scope})
+			return
+		}
+	}
+	log.Info("Delegate the token request from ", art.NfInstanceID, " to the parent server")
+	resp := s.forwardTokenRequest(c, s.parentClient, b, noCache)
+	if resp != nil && cacheable {
+		s.tokenCache.CacheGrantedToken(key, time.Now().Unix()+resp.ExpiresIn, resp.AccessToken, getGrantedScope(resp, art))
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"github.com/lestrrat-go/jwx/jwa"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDelegateTokenRequestToParent(t *testing.T) {
+	key, _ := loadSignatureKey([]byte(privateKey))
+	parent := NewOAuthServer("", "parent-nrf", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	parentStore := NewNFProfileStore()
+	parentStore.AddProfile(&NFProfile{NfInstanceID: "5a7bd676-ceeb-44bb-95e0-f6a55a312345", NfType: "AMF"})
+	parentStore.AddProfile(&NFProfile{NfInstanceID: "7e8f9a0b-1c2d-4e3f-8a4b-5c6d7e8fd001", NfType: "UDM"})
+	parent.SetNFProfileStore(parentStore)
+	parentRequests := 0
+	parentServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parentRequests++
+		parent.router.ServeHTTP(w, r)
+	}))
+	defer parentServer.Close()
+
+	local := NewOAuthServer("", "local-nrf", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	localStore := NewNFProfileStore()
+	localStore.AddProfile(&NFProfile{NfInstanceID: "5a7bd676-ceeb-44bb-95e0-f6a55a312345", NfType: "AMF"})
+	localStore.AddProfile(&NFProfile{NfInstanceID: "8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001", NfType: "AMF"})
+	local.SetNFProfileStore(localStore)
+	local.SetSnssaiList([]*Snssai{&Snssai{Sst: 1}})
+	local.SetParentServer(NewOAuthClient(parentServer.URL+"/oauth2/token", false, nil))
+	localServer := httptest.NewServer(local.router)
+	defer localServer.Close()
+
+	requestToken := func(targetNfType string, scope string, snssais []*Snssai) (int, *AccessTokenClaims, *AccessTokenError) {
+		req := createRoamingRequest(nil)
+		req.TargetNfType = targetNfType
+		req.Scope = scope
+		req.TargetSnssaiList = snssais
+		code, body := postTokenRequest(t, localServer.URL+"/oauth2/token", req)
+		if code != http.StatusOK {
+			accessTokenErr := &AccessTokenError{}
+			accessTokenErr.FromJSON(body)
+			return code, nil, accessTokenErr
+		}
+		resp := NewAccessTokenResponse()
+		resp.FromJSON(body)
+		claims, err := local.createVerifier().VerifyTokenClaims([]byte(resp.AccessToken))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code, claims, nil
+	}
+
+	if _, claims, _ := requestToken("AMF", "namf-comm", nil); claims == nil || claims.Iss != "local-nrf" || parentRequests != 0 {
+		t.Error("The request for the registered producer should be served locally")
+	}
+	if _, claims, _ := requestToken("UDM", "nudm-sdm", nil); claims == nil || claims.Iss != "parent-nrf" || parentRequests != 1 {
+		t.Error("The request for the unregistered producer should be delegated to the parent")
+	}
+	if _, claims, _ := requestToken("UDM", "nudm-sdm", nil); claims == nil || claims.Iss != "parent-nrf" || parentRequests != 1 {
+		t.Error("The token from the parent should be cached")
+	}
+	if _, claims, _ := requestToken("AMF", "namf-comm", []*Snssai{&Snssai{Sst: 2}}); claims == nil || claims.Iss != "parent-nrf" {
+		t.Error("The request for other S-NSSAI should be delegated to the parent")
+	}
+	code, _, accessTokenErr := requestToken("SMF", "nsmf-pdusession", nil)
+	if code != http.StatusBadRequest || accessTokenErr.Error != UnauthorizedClient {
+		t.Error("The error of the parent should be replied as it is ", code, accessTokenErr)
+	}
+
+	delegated := parentRequests
+	req := createRoamingRequest(nil)
+	req.NfInstanceID = "1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001"
+	code, body := postTokenRequest(t, localServer.URL+"/oauth2/token", req)
+	if code != http.StatusBadRequest || accessTokenErr.FromJSON(body) != nil || accessTokenErr.Error != InvalidClient {
+		t.Error("The unregistered consumer should be rejected before delegating ", code, string(body))
+	}
+	if code, _, accessTokenErr = requestToken("UDM", "unknown-service", nil); code != http.StatusBadRequest || accessTokenErr.Error != InvalidScope {
+		t.Error("The invalid request should be rejected before delegating ", code, accessTokenErr)
+	}
+	if parentRequests != delegated {
+		t.Error("The rejected requests should not be delegated to the parent")
+	}
+}
+
+func TestCacheGrantedScope(t *testing.T) {
+	parentRequests := 0
+	parentServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parentRequests++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"parent-token","token_type":"Bearer","expires_in":3600,"scope":"nudm-sdm"}`)
+	}))
+	defer parentServer.Close()
+
+	key, _ := loadSignatureKey([]byte(privateKey))
+	local := NewOAuthServer("", "local-nrf", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	local.SetSnssaiList([]*Snssai{&Snssai{Sst: 1}})
+	local.SetParentServer(NewOAuthClient(parentServer.URL+"/oauth2/token", false, nil))
+	localServer := httptest.NewServer(local.router)
+	defer localServer.Close()
+	pubKey, _ := loadSignatureKey([]byte(publicKey))
+	proxy := NewProxy("/reqtoken", "/verify", parentServer.URL+"/oauth2/token", nil, false, jwa.RS256, NewStaticKeySource(pubKey))
+
+	for i := 0; i < 2; i++ {
+		req := createRoamingRequest(nil)
+		req.Scope = "nudm-sdm nudm-uecm"
+		req.TargetSnssaiList = []*Snssai{&Snssai{Sst: 2}}
+		code, body := postTokenRequest(t, localServer.URL+"/oauth2/token", req)
+		resp := NewAccessTokenResponse()
+		if code != http.StatusOK || resp.FromJSON(body) != nil || resp.Scope != "nudm-sdm" {
+			t.Error("The scope granted by the parent should be replied ", code, string(body))
+		}
+
+		proxyResp, err := proxy.RequestToken(req)
+		if err != nil || proxyResp.Scope != "nudm-sdm" {
+			t.Error("The scope granted by the server should be replied by the proxy ", err)
+		}
+	}
+	if parentRequests != 2 {
+		t.Error("The tokens should be cached by the local server and the proxy ", parentRequests)
+	}
+}
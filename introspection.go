@@ -0,0 +1,79 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// IntrospectionResponse the token introspection response defined in RFC 7662
+// with the 5G claims of the active token
+type IntrospectionResponse struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	Exp       int64    `json:"exp,omitempty"`
+	Iat       int64    `json:"iat,omitempty"`
+	Nbf       int64    `json:"nbf,omitempty"`
+	Sub       string   `json:"sub,omitempty"`
+	Aud       []string `json:"aud,omitempty"`
+	Iss       string   `json:"iss,omitempty"`
+	Jti       string   `json:"jti,omitempty"`
+
+	ConsumerPlmnID     *PlmnID       `json:"consumerPlmnID,omitempty"`
+	ProducerPlmnID     *PlmnID       `json:"producerPlmnID,omitempty"`
+	ProducerSnssaiList []*Snssai     `json:"producerSnssaiList,omitempty"`
+	ProducerNsiList    []string      `json:"producerNsiList,omitempty"`
+	ProducerNfSetID    string        `json:"producerNfSetId,omitempty"`
+	ConsumerSnpnID     *PlmnIDNid    `json:"consumerSnpnId,omitempty"`
+	ProducerSnpnID     *PlmnIDNid    `json:"producerSnpnId,omitempty"`
+	Cnf                *Confirmation `json:"cnf,omitempty"`
+}
+
+// NewIntrospectionResponse create the response of an active token from its claims.
+// The response of an inactive token has only "active": false
+func NewIntrospectionResponse(claims *AccessTokenClaims) *IntrospectionResponse {
+	if claims == nil {
+		return &IntrospectionResponse{Active: false}
+	}
+	return &IntrospectionResponse{Active: true,
+		Scope:              claims.Scope,
+		ClientID:           claims.Sub,
+		TokenType:          "Bearer",
+		Exp:                claims.Exp,
+		Iat:                claims.Iat,
+		Nbf:                claims.Nbf,
+		Sub:                claims.Sub,
+		Aud:                claims.Aud,
+		Iss:                claims.Iss,
+		Jti:                claims.Jti,
+		ConsumerPlmnID:     claims.ConsumerPlmnID,
+		ProducerPlmnID:     claims.ProducerPlmnID,
+		ProducerSnssaiList: claims.ProducerSnssaiList,
+		ProducerNsiList:    claims.ProducerNsiList,
+		ProducerNfSetID:    claims.ProducerNfSetID,
+		ConsumerSnpnID:     claims.ConsumerSnpnID,
+		ProducerSnpnID:     claims.ProducerSnpnID,
+		Cnf:                claims.Cnf}
+}
+
+// handleIntrospection handle the introspection request in
+// application/x-www-form-urlencoded format with the token parameter
+func handleIntrospection(c *gin.Context, verifier *AccessTokenVerifier, authenticator *EndpointAuthenticator) {
+	if !authenticateEndpoint(c, authenticator, "introspection") {
+		return
+	}
+	token := c.PostForm("token")
+	if len(token) <= 0 {
+		c.JSON(http.StatusBadRequest, NewAccessTokenError(InvalidRequest))
+		return
+	}
+	claims, err := verifier.VerifyTokenClaims([]byte(token))
+	if err != nil {
+		log.Info("The introspected token is not active:", err)
+		claims = nil
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, NewIntrospectionResponse(claims))
+}
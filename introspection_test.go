@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"github.com/lestrrat-go/jwx/jwa"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func introspect(handler http.Handler, path string, token string, clientID string, secret string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(url.Values{"token": {token}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if len(clientID) > 0 {
+		req.SetBasicAuth(clientID, secret)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestServerIntrospection(t *testing.T) {
+	key, _ := loadSignatureKey([]byte(privateKey))
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	server.EnableIntrospection("/oauth2/introspect", NewEndpointAuthenticator(map[string]string{"amf": "amf-secret"}, false))
+	token, err := createTokenWithServer(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := introspect(server.router, "/oauth2/introspect", token, "amf", "wrong-secret")
+	if w.Code != http.StatusUnauthorized || len(w.Header().Get("WWW-Authenticate")) <= 0 {
+		t.Error("The caller with wrong secret should be rejected")
+	}
+	if w = introspect(server.router, "/oauth2/introspect", token, "", ""); w.Code != http.StatusUnauthorized {
+		t.Error("The caller without credentials should be rejected")
+	}
+	if w = introspect(server.router, "/oauth2/introspect", "", "amf", "amf-secret"); w.Code != http.StatusBadRequest {
+		t.Error("The request without token should be rejected")
+	}
+
+	w = introspect(server.router, "/oauth2/introspect", token, "amf", "amf-secret")
+	resp := &IntrospectionResponse{}
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), resp) != nil {
+		t.Fatal("Fail to introspect token ", w.Body.String())
+	}
+	if !resp.Active || resp.Scope != "namf-comm" || resp.Sub != "5a7bd676-ceeb-44bb-95e0-f6a55a312345" || resp.Iss != "instance-1" || resp.Exp <= 0 {
+		t.Error("Unexpected introspection response ", w.Body.String())
+	}
+	if len(resp.Aud) != 1 || resp.Aud[0] != "AMF" || len(resp.ProducerSnssaiList) != 2 {
+		t.Error("Unexpected introspection response ", w.Body.String())
+	}
+	if resp.Iat <= 0 || resp.Nbf != resp.Iat || len(resp.Jti) <= 0 {
+		t.Error("The iat, nbf and jti should be introspected ", w.Body.String())
+	}
+
+	w = introspect(server.router, "/oauth2/introspect", token+"x", "amf", "amf-secret")
+	if w.Code != http.StatusOK || w.Body.String() != `{"active":false}` {
+		t.Error("The invalid token should be inactive ", w.Body.String())
+	}
+}
+
+func TestIntrospectSnpnClaims(t *testing.T) {
+	claims := &AccessTokenClaims{Iss: "instance-1",
+		Sub:            "5a7bd676-ceeb-44bb-95e0-f6a55a312345",
+		Aud:            []string{"UDM"},
+		Scope:          "nudm-sdm",
+		Exp:            2000000000,
+		Nbf:            1600000000,
+		ConsumerSnpnID: &PlmnIDNid{Mcc: "460", Mnc: "00", Nid: "000007ed9d5"},
+		ProducerSnpnID: &PlmnIDNid{Mcc: "460", Mnc: "01", Nid: "000007ed9d6"}}
+	b, _ := json.Marshal(NewIntrospectionResponse(claims))
+	resp := &IntrospectionResponse{}
+	json.Unmarshal(b, resp)
+	if resp.Nbf != claims.Nbf || !claims.ConsumerSnpnID.Equal(resp.ConsumerSnpnID) || !claims.ProducerSnpnID.Equal(resp.ProducerSnpnID) {
+		t.Error("The SNPN claims should be introspected ", string(b))
+	}
+}
+
+func TestProxyIntrospection(t *testing.T) {
+	key, _ := loadSignatureKey([]byte(privateKey))
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	token, _ := createTokenWithServer(server)
+	pubKey, _ := loadSignatureKey([]byte(publicKey))
+	proxy := NewProxy("/reqtoken", "/verify", "http://127.0.0.1:1", nil, false, jwa.RS256, NewStaticKeySource(pubKey))
+	proxy.EnableIntrospection("/introspect", NewEndpointAuthenticator(map[string]string{"amf": "amf-secret"}, false))
+
+	w := introspect(proxy.router, "/introspect", token, "amf", "amf-secret")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"active":true`) {
+		t.Error("Fail to introspect token ", w.Body.String())
+	}
+}
+
+func TestIntrospectionClientCertificate(t *testing.T) {
+	authenticator := NewEndpointAuthenticator(nil, true)
+	req := httptest.NewRequest(http.MethodPost, "/introspect", nil)
+	if authenticator.Authenticate(req) {
+		t.Error("The caller without client certificate should be rejected")
+	}
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{&x509.Certificate{}}}}
+	if !authenticator.Authenticate(req) {
+		t.Error("The caller with verified client certificate should be accepted")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto"
+	"encoding/base64"
+	"fmt"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"io/ioutil"
+)
+
+// VerificationKeySource provides the key to verify the token signature
+type VerificationKeySource interface {
+	// GetKey get the signature algorithm and the key by the key id(kid) in the
+	// token header. The kid may be empty. The returned algorithm is empty if the
+	// key does not declare its algorithm
+	GetKey(kid string) (jwa.SignatureAlgorithm, interface{}, error)
+}
+
+// StaticKeySource a VerificationKeySource with only one key
+type StaticKeySource struct {
+	key interface{}
+}
+
+// NewStaticKeySource create a StaticKeySource with the key, the key is used
+// to verify any token no matter what kid is in the token
+func NewStaticKeySource(key interface{}) *StaticKeySource {
+	return &StaticKeySource{key: key}
+}
+
+// GetKey get the static key
+func (sks *StaticKeySource) GetKey(kid string) (jwa.SignatureAlgorithm, interface{}, error) {
+	if sks.key == nil {
+		return "", nil, fmt.Errorf("Fail to verify token because key is nil")
+	}
+	return "", sks.key, nil
+}
+
+// KeySetSource a VerificationKeySource selects the key from a JWK set by kid
+type KeySetSource struct {
+	keySet *jwk.Set
+}
+
+// NewKeySetSource create a KeySetSource with the JWK set
+func NewKeySetSource(keySet *jwk.Set) *KeySetSource {
+	return &KeySetSource{keySet: keySet}
+}
+
+// LoadKeySetSource load the JWK set from a json file
+func LoadKeySetSource(fileName string) (*KeySetSource, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	keySet, err := jwk.ParseBytes(b)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeySetSource(keySet), nil
+}
+
+// GetKey get the key by kid from the JWK set. If the kid is empty, the
+// only key in the set is returned
+func (kss *KeySetSource) GetKey(kid string) (jwa.SignatureAlgorithm, interface{}, error) {
+	return getKeyFromSet(kss.keySet, kid)
+}
+
+func getKeyFromSet(keySet *jwk.Set, kid string) (jwa.SignatureAlgorithm, interface{}, error) {
+	var key jwk.Key
+	if len(kid) > 0 {
+		keys := keySet.LookupKeyID(kid)
+		if len(keys) <= 0 {
+			return "", nil, fmt.Errorf("No key with kid %s", kid)
+		}
+		key = keys[0]
+	} else if len(keySet.Keys) == 1 {
+		key = keySet.Keys[0]
+	} else {
+		return "", nil, fmt.Errorf("No kid in token to select the key from %d keys", len(keySet.Keys))
+	}
+	var rawKey interface{}
+	if err := key.Raw(&rawKey); err != nil {
+		return "", nil, err
+	}
+	return jwa.SignatureAlgorithm(key.Algorithm()), rawKey, nil
+}
+
+// createPublicJWK create the public JWK of the key with the kid and algorithm
+func createPublicJWK(key interface{}, kid string, alg jwa.SignatureAlgorithm) (jwk.Key, error) {
+	publicKey, err := jwk.PublicKeyOf(key)
+	if err != nil {
+		return nil, err
+	}
+	k, err := jwk.New(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	k.Set(jwk.KeyIDKey, kid)
+	k.Set(jwk.AlgorithmKey, alg.String())
+	k.Set(jwk.KeyUsageKey, string(jwk.ForSignature))
+	return k, nil
+}
+
+// getKeyThumbprint get the base64url-encoded SHA-256 JWK thumbprint defined in
+// RFC 7638 of the public part of the key
+func getKeyThumbprint(key interface{}) (string, error) {
+	publicKey, err := jwk.PublicKeyOf(key)
+	if err != nil {
+		return "", err
+	}
+	k, err := jwk.New(publicKey)
+	if err != nil {
+		return "", err
+	}
+	b, err := k.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/lestrrat-go/jwx/jws"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestJWKSAndKeyID(t *testing.T) {
+	key, err := loadSignatureKey([]byte(privateKey))
+	if err != nil {
+		t.Fail()
+	}
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	server.SetKeyID("key-1")
+	server.EnableJWKS("/oauth2/jwks")
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/oauth2/jwks", nil))
+	if w.Code != http.StatusOK {
+		t.Fatal("Fail to get JWKS")
+	}
+	keySet, err := jwk.ParseBytes(w.Body.Bytes())
+	if err != nil || !bytes.HasPrefix(w.Body.Bytes(), []byte(`{"keys":`)) || len(keySet.Keys) != 1 || keySet.Keys[0].KeyID() != "key-1" {
+		t.Fatal("Invalid JWKS ", w.Body.String())
+	}
+
+	token, _ := createTokenWithServer(server)
+	msg, err := jws.Parse(bytes.NewBufferString(token))
+	if err != nil || msg.Signatures()[0].ProtectedHeaders().KeyID() != "key-1" {
+		t.Fail()
+	}
+	verifier := NewAccessTokenVerifierWithKeySource(jwa.RS256, NewKeySetSource(keySet))
+	if err = verifier.VerifyToken([]byte(token)); err != nil {
+		t.Error(err)
+	}
+
+	server.SetKeyID("key-2")
+	server.tokenCache = NewTokenCache(0)
+	token, _ = createTokenWithServer(server)
+	verifier = NewAccessTokenVerifierWithKeySource(jwa.RS256, NewKeySetSource(keySet))
+	if verifier.VerifyToken([]byte(token)) == nil {
+		t.Fail()
+	}
+	verifier = NewAccessTokenVerifierWithKeySource(jwa.RS384, NewKeySetSource(keySet))
+	if verifier.VerifyToken([]byte(token)) == nil {
+		t.Fail()
+	}
+}
+
+func TestDefaultKeyID(t *testing.T) {
+	privKey, _ := loadSignatureKey([]byte(privateKey))
+	pubKey, _ := loadSignatureKey([]byte(publicKey))
+	kid1, err := getKeyThumbprint(privKey)
+	if err != nil {
+		t.Fail()
+	}
+	kid2, err := getKeyThumbprint(pubKey)
+	if err != nil || kid1 != kid2 {
+		t.Fail()
+	}
+}
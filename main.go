@@ -1,17 +1,108 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
 	"github.com/lestrrat-go/jwx/jwa"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 	"gopkg.in/natefinch/lumberjack.v2"
 	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"net/http"
 	"net/url"
 	"os"
+	"reflect"
 	"strings"
 	"time"
 )
 
+// SecretConfig the symmetric secret of HMAC signature algorithm. The secret
+// is taken from the secret, the secretFile or the secretEnv in order
+type SecretConfig struct {
+	Secret     string `yaml:"secret,omitempty"`
+	SecretFile string `yaml:"secretFile,omitempty"`
+	SecretEnv  string `yaml:"secretEnv,omitempty"`
+}
+
+// IsConfigured return true if any of the secret, secretFile and secretEnv is set
+func (sc *SecretConfig) IsConfigured() bool {
+	return len(sc.Secret) > 0 || len(sc.SecretFile) > 0 || len(sc.SecretEnv) > 0
+}
+
+// LoadSecret load the secret
+func (sc *SecretConfig) LoadSecret() ([]byte, error) {
+	if len(sc.Secret) > 0 {
+		return []byte(sc.Secret), nil
+	}
+	if len(sc.SecretFile) > 0 {
+		b, err := ioutil.ReadFile(sc.SecretFile)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.TrimRight(b, "\r\n"), nil
+	}
+	if len(sc.SecretEnv) > 0 {
+		if secret, ok := os.LookupEnv(sc.SecretEnv); ok {
+			return []byte(secret), nil
+		}
+		return nil, fmt.Errorf("Environment variable %s is not set", sc.SecretEnv)
+	}
+	return nil, fmt.Errorf("No secret is configured")
+}
+
+// checkSymmetricSignature refuse to use the symmetric secret without TLS
+// unless in lab mode
+func checkSymmetricSignature(alg jwa.SignatureAlgorithm, tlsEnabled bool, labMode bool) error {
+	if !isSymmetricAlgorithm(alg) {
+		return nil
+	}
+	log.Warn("!!! The tokens are signed with the shared secret of ", alg, ", any party knows the secret can forge tokens. Use it ONLY in lab deployment !!!")
+	if !tlsEnabled && !labMode {
+		return fmt.Errorf("Signature algorithm %s without TLS is allowed only in lab mode", alg)
+	}
+	return nil
+}
+
+// EndpointConfig the configuration of the token introspection, revocation or
+// administration endpoint
+type EndpointConfig struct {
+	// the path of the endpoint
+	Path string `yaml:"path,omitempty"`
+	// the clients authenticated with HTTP Basic authentication
+	Clients []struct {
+		ClientID     string `yaml:"clientId"`
+		SecretConfig `yaml:",inline"`
+	} `yaml:"clients,omitempty"`
+	// true to accept the client with the certificate verified by mTLS
+	AllowClientCertificate bool `yaml:"allowClientCertificate,omitempty"`
+	// accept only the client certificates for the FQDNs if it is not empty
+	Fqdns []string `yaml:"fqdns,omitempty"`
+}
+
+// CreateAuthenticator create the EndpointAuthenticator with the clients
+func (ec *EndpointConfig) CreateAuthenticator() (*EndpointAuthenticator, error) {
+	credentials := make(map[string]string)
+	for _, client := range ec.Clients {
+		secret, err := client.LoadSecret()
+		if err != nil {
+			return nil, fmt.Errorf("Fail to load the secret of client %s with error:%v", client.ClientID, err)
+		}
+		credentials[client.ClientID] = string(secret)
+	}
+	authenticator := NewEndpointAuthenticator(credentials, ec.AllowClientCertificate)
+	authenticator.SetCertificateFqdns(ec.Fqdns)
+	return authenticator, nil
+}
+
+// GetPath get the path of the endpoint, the defaultPath if it is not configured
+func (ec *EndpointConfig) GetPath(defaultPath string) string {
+	if len(ec.Path) <= 0 {
+		return defaultPath
+	}
+	return ec.Path
+}
+
 // AuthServerConfig the configuration for server
 type AuthServerConfig struct {
 	ListenAddr   string `yaml:"listenAddr"`
@@ -19,11 +110,118 @@ type AuthServerConfig struct {
 	HTTP2        bool   `yaml:"http2"`
 	TLSCertFile  string `yaml:"tlsCertFile,omitempty"`
 	TLSKeyFile   string `yaml:"tlsKeyFile,omitempty"`
-	InstanceID   string `yaml:"instanceId"`
-	TokenExpire  int64  `yaml:"tokenExpire"`
-	Signature    struct {
+	// the CA certificates to verify the client certificate, mTLS is enabled if it is set
+	ClientCAFile string `yaml:"clientCaFile,omitempty"`
+	// true to bind the token to the client certificate if mTLS is enabled
+	CertificateBoundToken bool   `yaml:"certificateBoundToken,omitempty"`
+	InstanceID            string `yaml:"instanceId"`
+	TokenExpire           int64  `yaml:"tokenExpire"`
+	// the file contains the registered NF profiles
+	NfProfileFile string `yaml:"nfProfileFile,omitempty"`
+	// the file contains the authorization policy
+	PolicyFile string `yaml:"policyFile,omitempty"`
+	// one of "optional" and "required" to verify the client credentials assertion,
+	// disabled if it is empty
+	ClientAssertion string `yaml:"clientAssertion,omitempty"`
+	// the maximum lifetime in seconds of the accepted client credentials
+	// assertion, 300 by default
+	ClientAssertionMaxLifetime int64 `yaml:"clientAssertionMaxLifetime,omitempty"`
+	// enable the administration REST API if it is configured, the path
+	// prefix is /admin by default
+	Admin *EndpointConfig `yaml:"admin,omitempty"`
+	// the path to publish the JWK set, /oauth2/jwks by default
+	JwksPath string `yaml:"jwksPath,omitempty"`
+	// the base URL published as issuer in the authorization server metadata,
+	// derived from the request by default
+	Issuer string `yaml:"issuer,omitempty"`
+	// enable the token introspection endpoint if it is configured
+	Introspection *EndpointConfig `yaml:"introspection,omitempty"`
+	// the PLMNs served by the server, all the PLMNs if it is empty
+	PlmnList []*PlmnID `yaml:"plmnList,omitempty"`
+	// forward the token requests for the peer PLMN to its authorization
+	// server, and accept the requests from the consumers of the peer PLMN
+	PeerPlmns []struct {
+		PlmnID PlmnID `yaml:"plmnId"`
+		// the token endpoint of the peer authorization server, for example through the SEPP
+		URL          string `yaml:"url"`
+		HTTP2        bool   `yaml:"http2,omitempty"`
+		ClientID     string `yaml:"clientId,omitempty"`
+		SecretConfig `yaml:",inline"`
+		CaCertFile   string `yaml:"caCertFile,omitempty"`
+		CertFile     string `yaml:"certFile,omitempty"`
+		KeyFile      string `yaml:"keyFile,omitempty"`
+		// authenticate the token requests forwarded by the SEPP or NRF of
+		// the peer PLMN, the requesterPlmn of the peer PLMN is trusted
+		// only in the authenticated requests
+		// the fqdns of the SEPP or NRF are required if allowClientCertificate is true
+		Forwarder *EndpointConfig `yaml:"forwarder,omitempty"`
+	} `yaml:"peerPlmns,omitempty"`
+	// the S-NSSAIs served by the server, all the S-NSSAIs if it is empty
+	SnssaiList []*Snssai `yaml:"snssaiList,omitempty"`
+	// delegate the token requests for the unregistered producers or other
+	// S-NSSAIs to the parent server, for example the PLMN-level NRF
+	Parent *struct {
+		// the token endpoint of the parent server
+		URL          string `yaml:"url"`
+		HTTP2        bool   `yaml:"http2,omitempty"`
+		ClientID     string `yaml:"clientId,omitempty"`
+		SecretConfig `yaml:",inline"`
+		CaCertFile   string `yaml:"caCertFile,omitempty"`
+		CertFile     string `yaml:"certFile,omitempty"`
+		KeyFile      string `yaml:"keyFile,omitempty"`
+	} `yaml:"parent,omitempty"`
+	// enable the token revocation endpoint if it is configured
+	Revocation *struct {
+		EndpointConfig `yaml:",inline"`
+		// push the revocation list to the proxies when it is changed
+		Subscribers []struct {
+			URL          string `yaml:"url"`
+			ClientID     string `yaml:"clientId,omitempty"`
+			SecretConfig `yaml:",inline"`
+			CaCertFile   string `yaml:"caCertFile,omitempty"`
+			CertFile     string `yaml:"certFile,omitempty"`
+			KeyFile      string `yaml:"keyFile,omitempty"`
+		} `yaml:"subscribers,omitempty"`
+	} `yaml:"revocation,omitempty"`
+	// true to allow the insecure settings for test, e.g. HMAC signature
+	// without TLS
+	LabMode   bool `yaml:"labMode,omitempty"`
+	Signature struct {
 		Algorithm string
-		KeyFile   string `yaml:"keyFile"`
+		KeyFile   string `yaml:"keyFile,omitempty"`
+		// the secret of HMAC signature algorithm instead of the keyFile
+		SecretConfig `yaml:",inline"`
+		// sign the token with the key in a PKCS#11 token instead of the keyFile
+		Pkcs11 *struct {
+			// the PKCS#11 library, for example /usr/lib/softhsm/libsofthsm2.so
+			Module     string `yaml:"module"`
+			TokenLabel string `yaml:"tokenLabel"`
+			KeyLabel   string `yaml:"keyLabel"`
+			// the user PIN
+			SecretConfig `yaml:",inline"`
+		} `yaml:"pkcs11,omitempty"`
+		// sign the token by the remote signing service instead of the keyFile
+		Remote *struct {
+			URL string `yaml:"url"`
+			// the public key of the key kept by the signing service
+			PublicKeyFile string `yaml:"publicKeyFile"`
+			CaCertFile    string `yaml:"caCertFile,omitempty"`
+			CertFile      string `yaml:"certFile,omitempty"`
+			KeyFile       string `yaml:"keyFile,omitempty"`
+		} `yaml:"remote,omitempty"`
+		// the kid in the token header, the JWK thumbprint of the key by default
+		KeyID string `yaml:"keyId,omitempty"`
+		// rotate the signing key if the rotation is configured
+		Rotation *struct {
+			// the interval in seconds to rotate the key, no scheduled
+			// rotation if it is 0
+			Interval int64 `yaml:"interval,omitempty"`
+			// the time in seconds the retired key is published, the
+			// tokenExpire by default
+			Overlap int64 `yaml:"overlap,omitempty"`
+			// the JWK set file to keep the generated keys over restart
+			StateFile string `yaml:"stateFile"`
+		} `yaml:"rotation,omitempty"`
 	}
 }
 
@@ -76,6 +274,45 @@ func initLog(logFile string, strLevel string, logSize int, backups int) {
 	}
 }
 
+// getInlineSecrets get the secrets configured in the configuration file
+func (config *AuthServerConfig) getInlineSecrets() []string {
+	secrets := make([]string, 0)
+	collectInlineSecrets(reflect.ValueOf(config), &secrets)
+	return secrets
+}
+
+// collectInlineSecrets collect the secrets of all the SecretConfig in the
+// configuration value, so the secret of a new configuration section is not
+// missed
+func collectInlineSecrets(v reflect.Value, secrets *[]string) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			collectInlineSecrets(v.Elem(), secrets)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			collectInlineSecrets(v.Index(i), secrets)
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			collectInlineSecrets(v.MapIndex(key), secrets)
+		}
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(SecretConfig{}) {
+			if secret := v.FieldByName("Secret").String(); len(secret) > 0 {
+				*secrets = append(*secrets, secret)
+			}
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if len(v.Type().Field(i).PkgPath) <= 0 {
+				collectInlineSecrets(v.Field(i), secrets)
+			}
+		}
+	}
+}
+
 func loadAuthServerConfig(fileName string) (*AuthServerConfig, error) {
 	r := &AuthServerConfig{}
 	err := loadYamlConfig(fileName, r)
@@ -93,24 +330,293 @@ func startAuthServer(c *cli.Context) error {
 	backups := c.Int("log-backups")
 	initLog(fileName, strLevel, logSize, backups)
 	b, _ := toYamlBytes(config)
+	for _, secret := range config.getInlineSecrets() {
+		b = bytes.Replace(b, []byte(secret), []byte("******"), -1)
+	}
 	log.Info("Load configuration:", string(b))
 	alg := jwa.SignatureAlgorithm(config.Signature.Algorithm)
-	key, err := loadSignatureKeyFromFile(config.Signature.KeyFile)
+	err = checkSymmetricSignature(alg, len(config.TLSCertFile) > 0 && len(config.TLSKeyFile) > 0, config.LabMode)
 	if err != nil {
+		log.Error(err)
 		return err
 	}
-	return NewOAuthServer(config.TokenReqPath,
+	signer, err := createExternalSigner(config)
+	if err != nil {
+		log.Error("Fail to create the signer with error:", err)
+		return err
+	}
+	// no in-memory key if the key is kept by the external signer
+	var key interface{}
+	if signer == nil {
+		if isSymmetricAlgorithm(alg) {
+			key, err = config.Signature.LoadSecret()
+		} else {
+			key, err = loadSignatureKeyFromFile(config.Signature.KeyFile)
+		}
+		if err != nil {
+			return err
+		}
+		if err = checkSignatureKey(alg, key); err != nil {
+			log.Error("Invalid signature key file ", config.Signature.KeyFile, " with error:", err)
+			return err
+		}
+	}
+	server := NewOAuthServer(config.TokenReqPath,
 		config.InstanceID,
 		time.Duration(config.TokenExpire)*time.Second,
 		config.HTTP2,
 		config.TLSCertFile,
 		config.TLSKeyFile,
 		alg,
-		key).Start(config.ListenAddr)
+		key)
+	if signer != nil {
+		if err = server.SetSigner(signer); err != nil {
+			return err
+		}
+	}
+	if len(config.Signature.KeyID) > 0 {
+		server.SetKeyID(config.Signature.KeyID)
+	}
+	if config.Signature.Rotation != nil {
+		if len(config.Signature.Rotation.StateFile) <= 0 {
+			return fmt.Errorf("The signature.rotation.stateFile is required to keep the rotated keys")
+		}
+		err = server.EnableKeyRotation(time.Duration(config.Signature.Rotation.Interval)*time.Second,
+			time.Duration(config.Signature.Rotation.Overlap)*time.Second,
+			config.Signature.Rotation.StateFile)
+		if err != nil {
+			log.Error("Fail to enable key rotation with error:", err)
+			return err
+		}
+	}
+	if len(config.JwksPath) <= 0 {
+		config.JwksPath = "/oauth2/jwks"
+	}
+	server.EnableJWKS(config.JwksPath)
+	if len(config.NfProfileFile) > 0 {
+		store, err := LoadNFProfileStore(config.NfProfileFile)
+		if err != nil {
+			log.Error("Fail to load NF profiles from ", config.NfProfileFile, " with error:", err)
+			return err
+		}
+		server.SetNFProfileStore(store)
+	}
+	if len(config.PolicyFile) > 0 {
+		policy, err := LoadAuthorizationPolicy(config.PolicyFile)
+		if err != nil {
+			log.Error("Fail to load authorization policy from ", config.PolicyFile, " with error:", err)
+			return err
+		}
+		server.SetAuthorizationPolicy(policy)
+	}
+	switch config.ClientAssertion {
+	case "":
+	case "optional":
+		server.EnableClientAssertion(false, time.Duration(config.ClientAssertionMaxLifetime)*time.Second)
+	case "required":
+		server.EnableClientAssertion(true, time.Duration(config.ClientAssertionMaxLifetime)*time.Second)
+	default:
+		return fmt.Errorf("Invalid clientAssertion %s", config.ClientAssertion)
+	}
+	if len(config.ClientCAFile) > 0 {
+		server.EnableMutualTLS(config.ClientCAFile, config.CertificateBoundToken)
+	}
+	if config.Introspection != nil {
+		authenticator, err := config.Introspection.CreateAuthenticator()
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+		server.EnableIntrospection(config.Introspection.GetPath("/oauth2/introspect"), authenticator)
+	}
+	server.SetPlmnIDs(config.PlmnList)
+	for i := range config.PeerPlmns {
+		peer := &config.PeerPlmns[i]
+		tlsConfig, err := loadCertFile(peer.CaCertFile, peer.CertFile, peer.KeyFile)
+		if err != nil {
+			log.Error("Fail to load the certificates of PLMN ", peer.PlmnID.String(), " with error:", err)
+			return err
+		}
+		if strings.HasPrefix(peer.URL, "http://") {
+			tlsConfig = nil
+		}
+		client := NewOAuthClient(peer.URL, peer.HTTP2, tlsConfig)
+		if len(peer.ClientID) > 0 {
+			secret, err := peer.LoadSecret()
+			if err != nil {
+				return err
+			}
+			client.SetBasicAuth(peer.ClientID, string(secret))
+		}
+		var authenticator *EndpointAuthenticator
+		if peer.Forwarder != nil {
+			if peer.Forwarder.AllowClientCertificate && len(peer.Forwarder.Fqdns) <= 0 {
+				return fmt.Errorf("The client certificate of PLMN %s requires the fqdns", peer.PlmnID.String())
+			}
+			if authenticator, err = peer.Forwarder.CreateAuthenticator(); err != nil {
+				return err
+			}
+		}
+		server.AddPeerPlmn(&peer.PlmnID, client, authenticator)
+	}
+	server.SetSnssaiList(config.SnssaiList)
+	if config.Parent != nil {
+		if err = setParentServer(server, config); err != nil {
+			log.Error("Fail to set the parent server with error:", err)
+			return err
+		}
+	}
+	if config.Revocation != nil {
+		if err = enableRevocation(server, config); err != nil {
+			log.Error("Fail to enable token revocation with error:", err)
+			return err
+		}
+	}
+	if config.Admin != nil {
+		authenticator, err := config.Admin.CreateAuthenticator()
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+		if !authenticator.IsConfigured() {
+			return fmt.Errorf("The administration API requires clients or allowClientCertificate")
+		}
+		// any NF with a certificate of the CA is not an administrator
+		if config.Admin.AllowClientCertificate && len(config.Admin.Fqdns) <= 0 {
+			return fmt.Errorf("The client certificate of the administration API requires the fqdns")
+		}
+		server.EnableAdminAPI(config.Admin.GetPath("/admin"), authenticator)
+	}
+	server.EnableMetadata(config.Issuer)
+	return server.Start(config.ListenAddr)
+}
+
+// setParentServer delegate the token requests to the parent server
+func setParentServer(server *OAuthServer, config *AuthServerConfig) error {
+	parent := config.Parent
+	tlsConfig, err := loadCertFile(parent.CaCertFile, parent.CertFile, parent.KeyFile)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(parent.URL, "http://") {
+		tlsConfig = nil
+	}
+	client := NewOAuthClient(parent.URL, parent.HTTP2, tlsConfig)
+	if len(parent.ClientID) > 0 {
+		secret, err := parent.LoadSecret()
+		if err != nil {
+			return err
+		}
+		client.SetBasicAuth(parent.ClientID, string(secret))
+	}
+	server.SetParentServer(client)
+	return nil
+}
+
+// enableRevocation enable the token revocation endpoint and push the revocation
+// list to the subscribers
+func enableRevocation(server *OAuthServer, config *AuthServerConfig) error {
+	authenticator, err := config.Revocation.CreateAuthenticator()
+	if err != nil {
+		return err
+	}
+	server.EnableRevocation(config.Revocation.GetPath("/oauth2/revoke"), authenticator)
+	for _, subscriber := range config.Revocation.Subscribers {
+		tlsConfig, err := loadCertFile(subscriber.CaCertFile, subscriber.CertFile, subscriber.KeyFile)
+		if err != nil {
+			return err
+		}
+		client := NewOAuthClient(subscriber.URL, false, tlsConfig)
+		if len(subscriber.ClientID) > 0 {
+			secret, err := subscriber.LoadSecret()
+			if err != nil {
+				return err
+			}
+			client.SetBasicAuth(subscriber.ClientID, string(secret))
+		}
+		server.AddRevocationSubscriber(client, subscriber.URL)
+	}
+	return nil
+}
+
+// createExternalSigner create the PKCS#11 or the remote signer if it is
+// configured, the private key is kept outside the process
+func createExternalSigner(config *AuthServerConfig) (Signer, error) {
+	alg := jwa.SignatureAlgorithm(config.Signature.Algorithm)
+	if config.Signature.Pkcs11 != nil {
+		pin, err := config.Signature.Pkcs11.LoadSecret()
+		if err != nil {
+			return nil, err
+		}
+		return NewPKCS11Signer(alg,
+			config.Signature.Pkcs11.Module,
+			config.Signature.Pkcs11.TokenLabel,
+			string(pin),
+			config.Signature.Pkcs11.KeyLabel)
+	}
+	if config.Signature.Remote != nil {
+		remote := config.Signature.Remote
+		publicKey, err := loadSignatureKeyFromFile(remote.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if err = checkSignatureKey(alg, publicKey); err != nil {
+			return nil, err
+		}
+		tlsConfig, err := loadCertFile(remote.CaCertFile, remote.CertFile, remote.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return NewRemoteSigner(alg, remote.URL, NewOAuthClient(remote.URL, false, tlsConfig), publicKey), nil
+	}
+	return nil, nil
+}
+
+// ProducerProxyConfig the configuration of the authorizing proxy in front of
+// the NF service producer
+type ProducerProxyConfig struct {
+	ListenAddr  string `yaml:"listenAddr"`
+	HTTP2       bool   `yaml:"http2,omitempty"`
+	TLSCertFile string `yaml:"tlsCertFile,omitempty"`
+	TLSKeyFile  string `yaml:"tlsKeyFile,omitempty"`
+	// the CA certificates to verify the client certificate, mTLS is enabled if it is set
+	ClientCAFile string `yaml:"clientCaFile,omitempty"`
+	Upstream     struct {
+		URL        string `yaml:"url"`
+		HTTP2      bool   `yaml:"http2,omitempty"`
+		CaCertFile string `yaml:"caCertFile,omitempty"`
+		CertFile   string `yaml:"certFile,omitempty"`
+		KeyFile    string `yaml:"keyFile,omitempty"`
+	} `yaml:"upstream"`
+	// the scope required by the path prefix, the service name in the
+	// first path segment by default
+	ScopeMappings []*ScopeMapping `yaml:"scopeMappings,omitempty"`
+}
+
+// ConsumerProxyConfig the configuration of the egress proxy of the NF
+// service consumer
+type ConsumerProxyConfig struct {
+	ListenAddr  string `yaml:"listenAddr"`
+	HTTP2       bool   `yaml:"http2,omitempty"`
+	TLSCertFile string `yaml:"tlsCertFile,omitempty"`
+	TLSKeyFile  string `yaml:"tlsKeyFile,omitempty"`
+	// the identity of the consumer in the token request
+	NfInstanceID string `yaml:"nfInstanceId"`
+	NfType       string `yaml:"nfType"`
+	// the settings to connect the producers
+	Upstream struct {
+		HTTP2      bool   `yaml:"http2,omitempty"`
+		CaCertFile string `yaml:"caCertFile,omitempty"`
+		CertFile   string `yaml:"certFile,omitempty"`
+		KeyFile    string `yaml:"keyFile,omitempty"`
+	} `yaml:"upstream,omitempty"`
 }
 
 // AuthProxyConfig the configure for proxy
 type AuthProxyConfig struct {
+	// true to allow the insecure settings for test, e.g. HMAC signature
+	// without TLS
+	LabMode bool `yaml:"labMode,omitempty"`
 	Proxies []struct {
 		ListenAddr string `yaml:"listenAddr"`
 		AuthServer struct {
@@ -120,11 +626,65 @@ type AuthProxyConfig struct {
 			CaCertFile string `yaml:"caCertFile,omitempty"`
 			CertFile   string `yaml:"certFile,omitempty"`
 			KeyFile    string `yaml:"keyFile,omitempty"`
+			// the url is the base URL of the authorization server, and the token
+			// endpoint, the JWKS URL and the signature algorithm are got from
+			// its metadata defined in RFC 8414
+			Discovery bool `yaml:"discovery,omitempty"`
 		} `yaml:"authServer"`
 		TokenReqPath         string `yaml:"tokenReqPath"`
 		TokenVerifyPath      string `yaml:"tokenVerifyPath"`
 		TokenVerifyAlgorithm string `yaml:"tokenVerifyAlgorithm,omitempty"`
 		TokenVerifyKeyFile   string `yaml:"tokenVerifyKeyFile,omitempty"`
+		// the secret to verify the token if the tokenVerifyAlgorithm is HMAC
+		TokenVerifySecret SecretConfig `yaml:"tokenVerifySecret,omitempty"`
+		// the expected claims of the verified token, only the signature and
+		// the expiration time are checked if it is not configured
+		TokenVerifyOptions *VerificationOptions `yaml:"tokenVerifyOptions,omitempty"`
+		// the allowed clock difference in seconds with the authorization server
+		// when checking the exp, nbf and iat of the token
+		ClockSkew int64 `yaml:"clockSkew,omitempty"`
+		// fetch the keys from the JWKS URL of the authorization server instead
+		// of loading from the tokenVerifyKeyFile if it is set
+		TokenVerifyJwksURL string `yaml:"tokenVerifyJwksUrl,omitempty"`
+		// the interval in seconds to refresh the keys from JWKS URL, 300 by default
+		JwksRefreshInterval int64 `yaml:"jwksRefreshInterval,omitempty"`
+		// the header contains the client certificate forwarded by the TLS terminator
+		// of the producer to verify the certificate bound token
+		ClientCertHeader string `yaml:"clientCertHeader,omitempty"`
+		// the IP addresses or CIDRs of the TLS terminators trusted to set the
+		// clientCertHeader, required if the clientCertHeader is set
+		ClientCertHeaderSources []string `yaml:"clientCertHeaderSources,omitempty"`
+		// enable the token introspection endpoint if it is configured
+		Introspection *EndpointConfig `yaml:"introspection,omitempty"`
+		// get the revocation list from the authorization server
+		Revocation *struct {
+			// pull the revocation list from the url with the TLS settings of authServer
+			PullURL string `yaml:"pullUrl,omitempty"`
+			// the interval in seconds to pull the revocation list, 30 by default
+			PullInterval int64 `yaml:"pullInterval,omitempty"`
+			// the HTTP Basic authentication credentials to pull the revocation list
+			ClientID     string `yaml:"clientId,omitempty"`
+			SecretConfig `yaml:",inline"`
+			// accept the revocation list pushed by the authorization server
+			Push *EndpointConfig `yaml:"push,omitempty"`
+		} `yaml:"revocation,omitempty"`
+		// verify the token of the requests to the producer and forward the
+		// authorized requests to the producer if it is configured
+		Producer *ProducerProxyConfig `yaml:"producer,omitempty"`
+		// forward the requests of the consumer to the producers with the
+		// access token if it is configured
+		Consumer *ConsumerProxyConfig `yaml:"consumer,omitempty"`
+		// create the client credentials assertion for the local NF if
+		// the keyFile is configured
+		ClientAssertion struct {
+			// the nfInstanceId of the local NF
+			NfInstanceID string   `yaml:"nfInstanceId"`
+			Algorithm    string   `yaml:"algorithm"`
+			KeyFile      string   `yaml:"keyFile"`
+			Audience     []string `yaml:"audience,omitempty"`
+			// the expire duration in seconds, 60 by default
+			Expire int64 `yaml:"expire,omitempty"`
+		} `yaml:"clientAssertion,omitempty"`
 	}
 }
 
@@ -146,6 +706,23 @@ func loadAuthProxyConfig(fileName string) (*AuthProxyConfig, error) {
 
 	return r, nil
 }
+
+// loadVerificationKeySource load the JWK set from a .json or .jwks file, or the
+// public key from a PEM file. The public key must match the algorithm
+func loadVerificationKeySource(fileName string, alg jwa.SignatureAlgorithm) (VerificationKeySource, error) {
+	if strings.HasSuffix(fileName, ".json") || strings.HasSuffix(fileName, ".jwks") {
+		return LoadKeySetSource(fileName)
+	}
+	key, err := loadSignatureKeyFromFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkSignatureKey(alg, key); err != nil {
+		return nil, err
+	}
+	return NewStaticKeySource(key), nil
+}
+
 func startAuthProxy(c *cli.Context) error {
 	authProxyConfig, err := loadAuthProxyConfig(c.String("config"))
 	if err != nil {
@@ -157,13 +734,8 @@ func startAuthProxy(c *cli.Context) error {
 	backups := c.Int("log-backups")
 	initLog(fileName, strLevel, logSize, backups)
 
-	for _, item := range authProxyConfig.Proxies {
-		key, err := loadSignatureKeyFromFile(item.TokenVerifyKeyFile)
-		if err != nil {
-			log.Error("Fail to load key file ", item.TokenVerifyKeyFile, " with error:", err)
-			return err
-		}
-
+	for i := range authProxyConfig.Proxies {
+		item := &authProxyConfig.Proxies[i]
 		tlsConfig, err := loadCertFile(item.AuthServer.CaCertFile, item.AuthServer.CertFile, item.AuthServer.KeyFile)
 		if err != nil {
 			log.Error("Fail to load the certificate file ", item.AuthServer.CaCertFile)
@@ -181,20 +753,242 @@ func startAuthProxy(c *cli.Context) error {
 			log.Info("tlsConfig.ServerName is ", tlsConfig.ServerName)
 		}
 		tlsConfig.BuildNameToCertificate()
+		if item.AuthServer.Discovery {
+			metadata, err := FetchAuthServerMetadata(NewOAuthClient(item.AuthServer.URL, item.AuthServer.HTTP2, tlsConfig), item.AuthServer.URL)
+			if err != nil {
+				log.Error("Fail to get the metadata of authorization server ", item.AuthServer.URL, " with error:", err)
+				return err
+			}
+			log.Info("Get the token endpoint ", metadata.TokenEndpoint, " from the metadata of ", item.AuthServer.URL)
+			item.AuthServer.URL = metadata.TokenEndpoint
+			if len(item.TokenVerifyAlgorithm) <= 0 {
+				alg, err := metadata.GetAccessTokenSigningAlgorithm()
+				if err != nil {
+					log.Error(err)
+					return err
+				}
+				item.TokenVerifyAlgorithm = alg.String()
+			}
+			if len(item.TokenVerifyJwksURL) <= 0 && len(item.TokenVerifyKeyFile) <= 0 && !item.TokenVerifySecret.IsConfigured() {
+				item.TokenVerifyJwksURL = metadata.JwksURI
+			}
+			if item.Revocation != nil && len(item.Revocation.PullURL) <= 0 {
+				item.Revocation.PullURL = metadata.RevocationEndpoint
+			}
+		}
+		var keySource VerificationKeySource
+		if len(item.TokenVerifyJwksURL) > 0 {
+			refreshInterval := item.JwksRefreshInterval
+			if refreshInterval <= 0 {
+				refreshInterval = 300
+			}
+			remoteKeySet := NewRemoteKeySet(NewOAuthClient(item.TokenVerifyJwksURL, item.AuthServer.HTTP2, tlsConfig),
+				item.TokenVerifyJwksURL,
+				time.Duration(refreshInterval)*time.Second)
+			remoteKeySet.Start()
+			keySource = remoteKeySet
+		} else if item.TokenVerifySecret.IsConfigured() {
+			alg := jwa.SignatureAlgorithm(item.TokenVerifyAlgorithm)
+			err = checkSymmetricSignature(alg, strings.HasPrefix(item.AuthServer.URL, "https://"), authProxyConfig.LabMode)
+			if err != nil {
+				log.Error(err)
+				return err
+			}
+			secret, err := item.TokenVerifySecret.LoadSecret()
+			if err == nil {
+				err = checkSignatureKey(alg, secret)
+			}
+			if err != nil {
+				log.Error("Fail to load token verify secret with error:", err)
+				return err
+			}
+			keySource = NewStaticKeySource(secret)
+		} else {
+			keySource, err = loadVerificationKeySource(item.TokenVerifyKeyFile, jwa.SignatureAlgorithm(item.TokenVerifyAlgorithm))
+			if err != nil {
+				log.Error("Fail to load key file ", item.TokenVerifyKeyFile, " with error:", err)
+				return err
+			}
+		}
+		proxy := NewProxy(item.TokenReqPath,
+			item.TokenVerifyPath,
+			item.AuthServer.URL,
+			tlsConfig,
+			item.AuthServer.HTTP2,
+			jwa.SignatureAlgorithm(item.TokenVerifyAlgorithm),
+			keySource)
+		if len(item.ClientAssertion.KeyFile) > 0 {
+			if !IsValidUUID(item.ClientAssertion.NfInstanceID) {
+				return fmt.Errorf("Invalid nfInstanceId %s of the client assertion", item.ClientAssertion.NfInstanceID)
+			}
+			assertionKey, err := loadSignatureKeyFromFile(item.ClientAssertion.KeyFile)
+			if err != nil {
+				log.Error("Fail to load client assertion key file ", item.ClientAssertion.KeyFile, " with error:", err)
+				return err
+			}
+			if err = checkSignatureKey(jwa.SignatureAlgorithm(item.ClientAssertion.Algorithm), assertionKey); err != nil {
+				log.Error("Invalid client assertion key file ", item.ClientAssertion.KeyFile, " with error:", err)
+				return err
+			}
+			expire := item.ClientAssertion.Expire
+			if expire <= 0 {
+				expire = 60
+			}
+			proxy.SetClientAssertionSigner(item.ClientAssertion.NfInstanceID, NewClientAssertionSigner(jwa.SignatureAlgorithm(item.ClientAssertion.Algorithm),
+				assertionKey,
+				item.ClientAssertion.Audience,
+				time.Duration(expire)*time.Second))
+		}
+		if item.TokenVerifyOptions != nil {
+			proxy.SetVerificationOptions(item.TokenVerifyOptions)
+		}
+		if item.ClockSkew > 0 {
+			proxy.SetClockSkew(time.Duration(item.ClockSkew) * time.Second)
+		}
+		if len(item.ClientCertHeader) > 0 {
+			header, err := NewClientCertHeader(item.ClientCertHeader, item.ClientCertHeaderSources)
+			if err != nil {
+				log.Error(err)
+				return err
+			}
+			proxy.SetClientCertHeader(header)
+		}
+		if item.Introspection != nil {
+			authenticator, err := item.Introspection.CreateAuthenticator()
+			if err != nil {
+				log.Error(err)
+				return err
+			}
+			proxy.EnableIntrospection(item.Introspection.GetPath("/oauth2/introspect"), authenticator)
+		}
+		if revocation := item.Revocation; revocation != nil {
+			if len(revocation.PullURL) > 0 {
+				client := NewOAuthClient(revocation.PullURL, item.AuthServer.HTTP2, tlsConfig)
+				if len(revocation.ClientID) > 0 {
+					secret, err := revocation.LoadSecret()
+					if err != nil {
+						log.Error("Fail to load the secret to pull revocation list with error:", err)
+						return err
+					}
+					client.SetBasicAuth(revocation.ClientID, string(secret))
+				}
+				interval := revocation.PullInterval
+				if interval <= 0 {
+					interval = 30
+				}
+				proxy.StartRevocationPull(client, revocation.PullURL, time.Duration(interval)*time.Second)
+			}
+			if revocation.Push != nil {
+				authenticator, err := revocation.Push.CreateAuthenticator()
+				if err != nil {
+					log.Error(err)
+					return err
+				}
+				proxy.EnableRevocationPush(revocation.Push.GetPath("/oauth2/revocations"), authenticator)
+			}
+		}
+		if item.Producer != nil {
+			if err = startAuthorizingProxy(proxy, item.Producer); err != nil {
+				log.Error("Fail to start the authorizing proxy with error:", err)
+				return err
+			}
+		}
+		if item.Consumer != nil {
+			if err = startEgressProxy(proxy, item.Consumer); err != nil {
+				log.Error("Fail to start the egress proxy with error:", err)
+				return err
+			}
+		}
+		listenAddr := item.ListenAddr
 		go func() {
-			NewProxy(item.TokenReqPath,
-				item.TokenVerifyPath,
-				item.AuthServer.URL,
-				tlsConfig,
-				item.AuthServer.HTTP2,
-				jwa.SignatureAlgorithm(item.TokenVerifyAlgorithm),
-				key).Start(item.ListenAddr)
+			proxy.Start(listenAddr)
 		}()
 	}
 
-	for {
-		time.Sleep(time.Duration(5 * time.Second))
+	select {}
+}
+
+// startAuthorizingProxy start the authorizing proxy in front of the producer
+func startAuthorizingProxy(proxy *Proxy, config *ProducerProxyConfig) error {
+	upstream := config.Upstream
+	tlsConfig, err := loadCertFile(upstream.CaCertFile, upstream.CertFile, upstream.KeyFile)
+	if err != nil {
+		return err
 	}
+	authorizingProxy, err := proxy.CreateAuthorizingProxy(upstream.URL, upstream.HTTP2, tlsConfig)
+	if err != nil {
+		return err
+	}
+	for _, mapping := range config.ScopeMappings {
+		authorizingProxy.AddScopeMapping(mapping.PathPrefix, mapping.Scope)
+	}
+	if config.HTTP2 {
+		authorizingProxy.EnableHTTP2()
+	}
+	authorizingProxy.SetTLS(config.TLSCertFile, config.TLSKeyFile)
+	authorizingProxy.SetClientCA(config.ClientCAFile)
+	go func() {
+		if err := authorizingProxy.Start(config.ListenAddr); err != nil {
+			log.Error("Fail to start the authorizing proxy in ", config.ListenAddr, " with error:", err)
+		}
+	}()
+	return nil
+}
+
+// startEgressProxy start the egress proxy of the consumer
+func startEgressProxy(proxy *Proxy, config *ConsumerProxyConfig) error {
+	if !IsValidUUID(config.NfInstanceID) || !IsValidNFType(config.NfType) {
+		return fmt.Errorf("Invalid nfInstanceId %s or nfType %s of the consumer", config.NfInstanceID, config.NfType)
+	}
+	if proxy.clientAssertionSigner != nil && proxy.localNfInstanceID != config.NfInstanceID {
+		return fmt.Errorf("The nfInstanceId %s of the consumer does not match %s of the client assertion", config.NfInstanceID, proxy.localNfInstanceID)
+	}
+	upstream := config.Upstream
+	tlsConfig, err := loadCertFile(upstream.CaCertFile, upstream.CertFile, upstream.KeyFile)
+	if err != nil {
+		return err
+	}
+	egressProxy := proxy.CreateEgressProxy(config.NfInstanceID, config.NfType, upstream.HTTP2, tlsConfig)
+	if config.HTTP2 {
+		egressProxy.EnableHTTP2()
+	}
+	egressProxy.SetTLS(config.TLSCertFile, config.TLSKeyFile)
+	go func() {
+		if err := egressProxy.Start(config.ListenAddr); err != nil {
+			log.Error("Fail to start the egress proxy in ", config.ListenAddr, " with error:", err)
+		}
+	}()
+	return nil
+}
+
+// rotateSigningKey ask the authorization server to rotate its signing key
+// through the administration REST API
+func rotateSigningKey(c *cli.Context) error {
+	tlsConfig, err := loadCertFile(c.String("ca-cert"), c.String("cert"), c.String("key"))
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(c.String("url"), "/")+"/keys/rotate", nil)
+	if err != nil {
+		return err
+	}
+	if len(c.String("client-id")) > 0 {
+		req.SetBasicAuth(c.String("client-id"), c.String("secret"))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Fail to rotate signing key with status code %d", resp.StatusCode)
+	}
+	fmt.Println(string(b))
 	return nil
 }
 
@@ -261,10 +1055,43 @@ func main() {
 		},
 		Action: startAuthProxy,
 	}
+	rotateKeyCommand := &cli.Command{
+		Name:  "rotate-key",
+		Usage: "rotate the signing key of oauth server",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "url",
+				Required: true,
+				Usage:    "the administration REST API url of oauth server, for example http://127.0.0.1:8081/admin",
+			},
+			&cli.StringFlag{
+				Name:  "ca-cert",
+				Usage: "the CA certificate file to verify the oauth server",
+			},
+			&cli.StringFlag{
+				Name:  "cert",
+				Usage: "the client certificate file",
+			},
+			&cli.StringFlag{
+				Name:  "key",
+				Usage: "the client private key file",
+			},
+			&cli.StringFlag{
+				Name:  "client-id",
+				Usage: "the client id of HTTP Basic authentication",
+			},
+			&cli.StringFlag{
+				Name:    "secret",
+				EnvVars: []string{"OAUTH5G_ADMIN_SECRET"},
+				Usage:   "the secret of HTTP Basic authentication",
+			},
+		},
+		Action: rotateSigningKey,
+	}
 	app := &cli.App{
 		Name:     "rest-oauth-proxy",
 		Usage:    "oauth-proxy with rest interface",
-		Commands: []*cli.Command{serverCommand, proxyCommand},
+		Commands: []*cli.Command{serverCommand, proxyCommand, rotateKeyCommand},
 	}
 	err := app.Run(os.Args)
 	if err != nil {
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"github.com/lestrrat-go/jwx/jwa"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestLoadSecret(t *testing.T) {
+	f, err := ioutil.TempFile("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("secret-in-file\n")
+	f.Close()
+
+	config := &SecretConfig{}
+	if config.IsConfigured() {
+		t.Fail()
+	}
+	config.SecretFile = f.Name()
+	secret, err := config.LoadSecret()
+	if err != nil || string(secret) != "secret-in-file" {
+		t.Fail()
+	}
+	config.Secret = "inline-secret"
+	secret, err = config.LoadSecret()
+	if err != nil || string(secret) != "inline-secret" {
+		t.Fail()
+	}
+
+	config = &SecretConfig{SecretEnv: "OAUTH5G_TEST_SECRET"}
+	os.Unsetenv("OAUTH5G_TEST_SECRET")
+	if _, err = config.LoadSecret(); err == nil {
+		t.Fail()
+	}
+	os.Setenv("OAUTH5G_TEST_SECRET", "env-secret")
+	defer os.Unsetenv("OAUTH5G_TEST_SECRET")
+	secret, err = config.LoadSecret()
+	if err != nil || string(secret) != "env-secret" {
+		t.Fail()
+	}
+}
+
+func TestCheckSymmetricSignature(t *testing.T) {
+	if checkSymmetricSignature(jwa.HS256, false, false) == nil {
+		t.Error("HMAC without TLS should be refused out of lab mode")
+	}
+	if checkSymmetricSignature(jwa.HS256, false, true) != nil || checkSymmetricSignature(jwa.HS256, true, false) != nil {
+		t.Fail()
+	}
+	if checkSymmetricSignature(jwa.RS256, false, false) != nil {
+		t.Fail()
+	}
+}
+
+func TestGetInlineSecrets(t *testing.T) {
+	config := &AuthServerConfig{}
+	err := yaml.Unmarshal([]byte(`
+admin:
+  clients:
+  - clientId: admin
+    secret: admin-secret
+peerPlmns:
+- plmnId:
+    mcc: "460"
+    mnc: "01"
+  url: "https://sepp.example.com/oauth2/token"
+  clientId: nrf-46000
+  secret: peer-secret
+  forwarder:
+    clients:
+    - clientId: sepp-46001
+      secret: forwarder-secret
+parent:
+  url: "https://nrf.example.com/oauth2/token"
+  clientId: local-nrf
+  secretEnv: PARENT_SECRET
+signature:
+  algorithm: HS256
+  secret: signature-secret
+`), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secrets := config.getInlineSecrets()
+	sort.Strings(secrets)
+	if !reflect.DeepEqual(secrets, []string{"admin-secret", "forwarder-secret", "peer-secret", "signature-secret"}) {
+		t.Error("All the inline secrets should be masked ", secrets)
+	}
+}
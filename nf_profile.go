@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// NFStatusRegistered the NF instance is registered and available
+	NFStatusRegistered string = "REGISTERED"
+	// NFStatusSuspended the NF instance is registered but not operative
+	NFStatusSuspended string = "SUSPENDED"
+	// NFStatusUndiscoverable the NF instance is registered but not discoverable
+	NFStatusUndiscoverable string = "UNDISCOVERABLE"
+)
+
+// NFService the NF service instance offered by a NF instance, defined
+// in TS 29.510 clause 6.1.6.2.3
+type NFService struct {
+	ServiceInstanceID string `json:"serviceInstanceId" yaml:"serviceInstanceId"`
+	// defined in TS 29.510 6.1.6.3.11
+	ServiceName     string    `json:"serviceName" yaml:"serviceName"`
+	NfServiceStatus string    `json:"nfServiceStatus,omitempty" yaml:"nfServiceStatus,omitempty"`
+	Fqdn            string    `json:"fqdn,omitempty" yaml:"fqdn,omitempty"`
+	AllowedPlmns    []*PlmnID `json:"allowedPlmns,omitempty" yaml:"allowedPlmns,omitempty"`
+	AllowedNfTypes  []string  `json:"allowedNfTypes,omitempty" yaml:"allowedNfTypes,omitempty"`
+	AllowedNssais   []*Snssai `json:"allowedNssais,omitempty" yaml:"allowedNssais,omitempty"`
+}
+
+// NFProfile the profile of a NF instance registered in the NRF, modelled on
+// the NFProfile defined in TS 29.510 clause 6.1.6.2.2
+type NFProfile struct {
+	// in uuid format
+	NfInstanceID   string `json:"nfInstanceId" yaml:"nfInstanceId"`
+	NfInstanceName string `json:"nfInstanceName,omitempty" yaml:"nfInstanceName,omitempty"`
+	// NFType in TS29501_Nnrf_NFManagement.yaml clause 6.1.6.3.3
+	NfType string `json:"nfType" yaml:"nfType"`
+	// one of REGISTERED, SUSPENDED and UNDISCOVERABLE, REGISTERED if it is empty
+	NfStatus       string       `json:"nfStatus,omitempty" yaml:"nfStatus,omitempty"`
+	PlmnList       []*PlmnID    `json:"plmnList,omitempty" yaml:"plmnList,omitempty"`
+	SNssais        []*Snssai    `json:"sNssais,omitempty" yaml:"sNssais,omitempty"`
+	NsiList        []string     `json:"nsiList,omitempty" yaml:"nsiList,omitempty"`
+	Fqdn           string       `json:"fqdn,omitempty" yaml:"fqdn,omitempty"`
+	Ipv4Addresses  []string     `json:"ipv4Addresses,omitempty" yaml:"ipv4Addresses,omitempty"`
+	Ipv6Addresses  []string     `json:"ipv6Addresses,omitempty" yaml:"ipv6Addresses,omitempty"`
+	AllowedPlmns   []*PlmnID    `json:"allowedPlmns,omitempty" yaml:"allowedPlmns,omitempty"`
+	AllowedNfTypes []string     `json:"allowedNfTypes,omitempty" yaml:"allowedNfTypes,omitempty"`
+	AllowedNssais  []*Snssai    `json:"allowedNssais,omitempty" yaml:"allowedNssais,omitempty"`
+	NfSetIDList    []string     `json:"nfSetIdList,omitempty" yaml:"nfSetIdList,omitempty"`
+	NfServices     []*NFService `json:"nfServices,omitempty" yaml:"nfServices,omitempty"`
+	// the public key or certificate in PEM format to verify the client
+	// credentials assertion signed by the NF instance
+	ClientPublicKey string `json:"clientPublicKey,omitempty" yaml:"clientPublicKey,omitempty"`
+}
+
+// CheckValid check if the mandatory fields of the NFProfile are valid
+func (p *NFProfile) CheckValid() error {
+	if len(p.NfInstanceID) <= 0 {
+		return fmt.Errorf("Missing nfInstanceId in NF profile")
+	}
+	if !IsValidNFType(p.NfType) {
+		return fmt.Errorf("Invalid nfType %s in NF profile %s", p.NfType, p.NfInstanceID)
+	}
+	switch p.NfStatus {
+	case "", NFStatusRegistered, NFStatusSuspended, NFStatusUndiscoverable:
+	default:
+		return fmt.Errorf("Invalid nfStatus %s in NF profile %s", p.NfStatus, p.NfInstanceID)
+	}
+	if len(p.ClientPublicKey) > 0 {
+		if _, err := loadSignatureKey([]byte(p.ClientPublicKey)); err != nil {
+			return fmt.Errorf("Invalid clientPublicKey in NF profile %s: %v", p.NfInstanceID, err)
+		}
+	}
+	for _, service := range p.NfServices {
+		if !IsValidServiceName(service.ServiceName) {
+			return fmt.Errorf("Invalid serviceName %s in NF profile %s", service.ServiceName, p.NfInstanceID)
+		}
+	}
+	return nil
+}
+
+// IsRegistered return true if the NF instance is in REGISTERED status
+func (p *NFProfile) IsRegistered() bool {
+	return len(p.NfStatus) <= 0 || p.NfStatus == NFStatusRegistered
+}
+
+// IsNfTypeAllowed return true if the NF instance allows the access
+// from the NF with nfType. All the NF types are allowed if the
+// allowedNfTypes is empty
+func (p *NFProfile) IsNfTypeAllowed(nfType string) bool {
+	if len(p.AllowedNfTypes) <= 0 {
+		return true
+	}
+	for _, t := range p.AllowedNfTypes {
+		if t == nfType {
+			return true
+		}
+	}
+	return false
+}
+
+// NFProfileStore keeps the profiles of the registered NF instances.
+// The authorization server uses it to check if a NF instance is known
+type NFProfileStore struct {
+	sync.Mutex
+	profiles map[string]*NFProfile
+}
+
+// NewNFProfileStore create a empty NFProfileStore object
+func NewNFProfileStore() *NFProfileStore {
+	return &NFProfileStore{profiles: make(map[string]*NFProfile)}
+}
+
+// LoadNFProfileStore create a NFProfileStore from a yaml or json(file name
+// ends with .json) file. The file contains a list of NFProfile under "nfProfiles"
+func LoadNFProfileStore(fileName string) (*NFProfileStore, error) {
+	r := struct {
+		NfProfiles []*NFProfile `json:"nfProfiles" yaml:"nfProfiles"`
+	}{}
+	if strings.HasSuffix(fileName, ".json") {
+		b, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(b, &r); err != nil {
+			return nil, err
+		}
+	} else if err := loadYamlConfig(fileName, &r); err != nil {
+		return nil, err
+	}
+	store := NewNFProfileStore()
+	for _, profile := range r.NfProfiles {
+		if _, err := store.AddProfile(profile); err != nil {
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+// AddProfile add a NFProfile to the store, the existing profile with
+// same nfInstanceId will be replaced. Return true if a existing profile
+// is replaced
+func (s *NFProfileStore) AddProfile(profile *NFProfile) (bool, error) {
+	if err := profile.CheckValid(); err != nil {
+		return false, err
+	}
+	s.Lock()
+	defer s.Unlock()
+
+	_, exists := s.profiles[profile.NfInstanceID]
+	s.profiles[profile.NfInstanceID] = profile
+	return exists, nil
+}
+
+// RemoveProfile remove the NFProfile by the nfInstanceId. Return false
+// if no such profile
+func (s *NFProfileStore) RemoveProfile(nfInstanceID string) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	_, exists := s.profiles[nfInstanceID]
+	delete(s.profiles, nfInstanceID)
+	return exists
+}
+
+// GetProfile get the NFProfile by the nfInstanceId
+func (s *NFProfileStore) GetProfile(nfInstanceID string) (*NFProfile, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	profile, ok := s.profiles[nfInstanceID]
+	return profile, ok
+}
+
+// GetProfiles get all the NFProfile sorted by nfInstanceId
+func (s *NFProfileStore) GetProfiles() []*NFProfile {
+	s.Lock()
+	defer s.Unlock()
+
+	profiles := make([]*NFProfile, 0, len(s.profiles))
+	for _, profile := range s.profiles {
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].NfInstanceID < profiles[j].NfInstanceID
+	})
+	return profiles
+}
+
+// GetProfilesByNfType get the registered NFProfile with the nfType
+func (s *NFProfileStore) GetProfilesByNfType(nfType string) []*NFProfile {
+	profiles := make([]*NFProfile, 0)
+	for _, profile := range s.GetProfiles() {
+		if profile.NfType == nfType && profile.IsRegistered() {
+			profiles = append(profiles, profile)
+		}
+	}
+	return profiles
+}
@@ -17,6 +17,24 @@ type OAuthClient struct {
 	serverURL        string
 	tlsClientConfig  *tls.Config
 	http2OAuthServer bool
+	// the HTTP Basic authentication credentials if the clientID is not empty
+	clientID     string
+	clientSecret string
+}
+
+// TokenRequestError the error of the token request replied with a non-2xx
+// status code by the authorization server
+type TokenRequestError struct {
+	StatusCode int
+	// the error replied by the server, nil if the reply is not a AccessTokenError
+	AccessTokenError *AccessTokenError
+}
+
+func (e *TokenRequestError) Error() string {
+	if e.AccessTokenError != nil {
+		return fmt.Sprintf("Not 2xx status code %d with error %s", e.StatusCode, e.AccessTokenError.Error)
+	}
+	return fmt.Sprintf("Not 2xx status code %d", e.StatusCode)
 }
 
 // NewOAuthClient create a OAuthClient object with:
@@ -29,10 +47,36 @@ func NewOAuthClient(serverURL string, http2OAuthServer bool, tlsClientConfig *tl
 		tlsClientConfig:  tlsClientConfig}
 }
 
+// SetBasicAuth authenticate the requests with HTTP Basic authentication
+func (oc *OAuthClient) SetBasicAuth(clientID string, clientSecret string) {
+	oc.clientID = clientID
+	oc.clientSecret = clientSecret
+}
+
+func (oc *OAuthClient) setRequestHeaders(request *http.Request) {
+	if oc.tlsClientConfig != nil && len(oc.tlsClientConfig.ServerName) > 0 {
+		request.Host = oc.tlsClientConfig.ServerName
+	}
+	if len(oc.clientID) > 0 {
+		request.SetBasicAuth(oc.clientID, oc.clientSecret)
+	}
+}
+
 // RequestToken request a token from the authorization server
 // data - is the AccessTokenRequest object encoded in application/x-www-form-urlencoded
 // format
 func (oc *OAuthClient) RequestToken(data []byte) ([]byte, error) {
+	return oc.requestToken(data, false)
+}
+
+// RequestNewToken request a token like RequestToken, but the authorization
+// server is asked not to reply the token from its cache, for example the
+// cached token is rejected by the producer
+func (oc *OAuthClient) RequestNewToken(data []byte) ([]byte, error) {
+	return oc.requestToken(data, true)
+}
+
+func (oc *OAuthClient) requestToken(data []byte, noCache bool) ([]byte, error) {
 	var client *http.Client = oc.createHTTPClient()
 
 	request, err := http.NewRequest("POST", oc.serverURL, bytes.NewBuffer(data))
@@ -41,9 +85,10 @@ func (oc *OAuthClient) RequestToken(data []byte) ([]byte, error) {
 		return nil, err
 	}
 	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	if oc.tlsClientConfig != nil && len(oc.tlsClientConfig.ServerName) > 0 {
-		request.Host = oc.tlsClientConfig.ServerName
+	if noCache {
+		request.Header.Set("Cache-Control", "no-cache")
 	}
+	oc.setRequestHeaders(request)
 
 	//resp, err := client.Post(oc.serverURL, "application/x-www-form-urlencoded", bytes.NewBuffer(data) )
 	resp, err := client.Do(request)
@@ -58,28 +103,91 @@ func (oc *OAuthClient) RequestToken(data []byte) ([]byte, error) {
 		return ioutil.ReadAll(resp.Body)
 	}
 	log.Error("Fail to get token from ", oc.serverURL, " with status code:", resp.StatusCode)
+	tokenReqErr := &TokenRequestError{StatusCode: resp.StatusCode}
+	if b, err := ioutil.ReadAll(resp.Body); err == nil {
+		accessTokenErr := &AccessTokenError{}
+		if accessTokenErr.FromJSON(b) == nil && len(accessTokenErr.Error) > 0 {
+			tokenReqErr.AccessTokenError = accessTokenErr
+		}
+	}
+	return nil, tokenReqErr
+}
+
+// Get get the resource, for example the JWK set, from the authorization
+// server with the same http client settings for the token request
+func (oc *OAuthClient) Get(resourceURL string) ([]byte, error) {
+	var client *http.Client = oc.createHTTPClient()
+
+	request, err := http.NewRequest("GET", resourceURL, nil)
+	if err != nil {
+		log.Error("Fail to get ", resourceURL, " with error:", err)
+		return nil, err
+	}
+	oc.setRequestHeaders(request)
+	resp, err := client.Do(request)
+	if err != nil {
+		log.Error("Fail to get ", resourceURL, " with error:", err)
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		return ioutil.ReadAll(resp.Body)
+	}
+	log.Error("Fail to get ", resourceURL, " with status code:", resp.StatusCode)
+	return nil, fmt.Errorf("Not 2xx status code %d", resp.StatusCode)
+}
+
+// Post post the data to the resource, for example the remote signing service,
+// with the same http client settings for the token request
+func (oc *OAuthClient) Post(resourceURL string, contentType string, data []byte) ([]byte, error) {
+	var client *http.Client = oc.createHTTPClient()
+
+	request, err := http.NewRequest("POST", resourceURL, bytes.NewBuffer(data))
+	if err != nil {
+		log.Error("Fail to post to ", resourceURL, " with error:", err)
+		return nil, err
+	}
+	request.Header.Add("Content-Type", contentType)
+	oc.setRequestHeaders(request)
+	resp, err := client.Do(request)
+	if err != nil {
+		log.Error("Fail to post to ", resourceURL, " with error:", err)
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		return ioutil.ReadAll(resp.Body)
+	}
+	log.Error("Fail to post to ", resourceURL, " with status code:", resp.StatusCode)
 	return nil, fmt.Errorf("Not 2xx status code %d", resp.StatusCode)
 }
 
 func (oc *OAuthClient) createHTTPClient() *http.Client {
-	if oc.http2OAuthServer {
-		return &http.Client{
-			Transport: &http2.Transport{
-				TLSClientConfig: oc.tlsClientConfig,
-				AllowHTTP:       true,
-				DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
-					if cfg == nil {
-						return net.Dial(network, addr)
-					}
-					return tls.Dial(network, addr, cfg)
-				},
+	return &http.Client{Transport: createTransport(oc.http2OAuthServer, oc.tlsClientConfig)}
+}
+
+// createTransport create the transport of HTTP/1.1, or HTTP/2 with prior
+// knowledge(h2c) if the tlsClientConfig is nil
+func createTransport(http2Server bool, tlsClientConfig *tls.Config) http.RoundTripper {
+	if http2Server {
+		return &http2.Transport{
+			TLSClientConfig: tlsClientConfig,
+			AllowHTTP:       true,
+			// the cfg is never nil, it is created from the TLSClientConfig
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				if tlsClientConfig == nil {
+					return net.Dial(network, addr)
+				}
+				return tls.Dial(network, addr, cfg)
 			},
 		}
 	}
-	var transport *http.Transport = nil
-	if oc.tlsClientConfig != nil {
-		transport = &http.Transport{TLSClientConfig: oc.tlsClientConfig}
+	if tlsClientConfig != nil {
+		return &http.Transport{TLSClientConfig: tlsClientConfig}
 	}
-	return &http.Client{Transport: transport}
-
+	return http.DefaultTransport
 }
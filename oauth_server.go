@@ -2,14 +2,19 @@ package main
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/lestrrat-go/jwx/jwa"
-	"github.com/lestrrat-go/jwx/jwt"
+	"github.com/lestrrat-go/jwx/jwk"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -17,10 +22,8 @@ import (
 // The authorization server will access the AccessTokenRequest and
 // reply the request with AccessTokenResponse.
 type OAuthServer struct {
-	// signature algorithm
-	alg jwa.SignatureAlgorithm
-	// signature key
-	key interface{}
+	// the signature algorithm and keys
+	keyManager *SigningKeyManager
 	// true to enable http2
 	http2       bool
 	tlsCertFile string
@@ -30,6 +33,42 @@ type OAuthServer struct {
 	instanceID  string
 	tokenExpire time.Duration
 	tokenCache  *TokenCache
+	// the registered NF instances
+	nfProfileStore *NFProfileStore
+	// the policy to authorize the token request
+	policy *AuthorizationPolicy
+	// verify the client credentials assertion
+	clientAssertionVerifier *ClientAssertionVerifier
+	// true if the client credentials assertion is mandatory
+	clientAssertionRequired bool
+	// the CA certificates to verify the client certificate, mTLS is
+	// enabled if it is not empty
+	clientCAFile string
+	// true to bind the token to the client certificate
+	certificateBoundToken bool
+	// the revoked tokens
+	revocationList *RevocationList
+	// the endpoints published in the authorization server metadata
+	tokenReqPath      string
+	jwksPath          string
+	introspectionPath string
+	revocationPath    string
+	// the authenticators of the introspection and revocation endpoints
+	introspectionAuthenticator *EndpointAuthenticator
+	revocationAuthenticator    *EndpointAuthenticator
+	// the authenticator of the administration API, its callers can revoke
+	// any token
+	adminAuthenticator *EndpointAuthenticator
+	// the PLMNs served by the server, all the PLMNs if it is empty
+	plmnIDs []*PlmnID
+	// the clients to the authorization servers of the peer PLMNs
+	peerPlmnClients map[string]*OAuthClient
+	// the authenticators of the requests forwarded from the peer PLMNs
+	peerPlmnAuthenticators map[string]*EndpointAuthenticator
+	// the client to the parent authorization server in the hierarchical deployment
+	parentClient *OAuthClient
+	// the S-NSSAIs served by the server, all the S-NSSAIs if it is empty
+	snssaiList []*Snssai
 }
 
 // NewOAuthServer create a NewOAuthServer server
@@ -49,36 +88,173 @@ func NewOAuthServer(tokenReqPath string,
 		http2:       http2,
 		tlsCertFile: tlsCertFile,
 		tlsKeyFile:  tlsKeyFile,
-		alg:         alg,
-		key:         key,
 		tokenCache:  NewTokenCache(int64(tokenExpire.Seconds() / 2))}
+	server.revocationList = NewRevocationList(tokenExpire)
+	// the revoked token must not be replied from the cache
+	server.revocationList.AddListener(func(*RevocationListData) {
+		server.tokenCache.Clear()
+	})
+	var keyID string
+	if key != nil && !isSymmetricAlgorithm(alg) {
+		var err error
+		keyID, err = getKeyThumbprint(key)
+		if err != nil {
+			log.Error("Fail to create key id with error:", err)
+		}
+	}
+	server.keyManager = NewSigningKeyManager(alg, key, keyID, tokenExpire)
 	if len(tokenReqPath) <= 0 {
 		tokenReqPath = "/oauth2/token"
 	}
+	server.tokenReqPath = tokenReqPath
 	router.POST(tokenReqPath, server.HandleTokenRequest)
 	return server
 }
 
+// SetSigner sign the token with the signer instead of the in-memory key, for
+// example with the key in a HSM. The kid is the JWK thumbprint of the public key
+func (s *OAuthServer) SetSigner(signer Signer) error {
+	keyID, err := getKeyThumbprint(signer.Public())
+	if err != nil {
+		return err
+	}
+	s.keyManager.SetActiveSigner(signer, keyID)
+	return nil
+}
+
+// SetKeyID set the key id(kid) of the signature key. The kid is the JWK
+// thumbprint defined in RFC 7638 of the key by default
+func (s *OAuthServer) SetKeyID(keyID string) {
+	s.keyManager.SetActiveKeyID(keyID)
+}
+
+// EnableKeyRotation prepare the next signing key and rotate the signing key
+// every interval if the interval is greater than 0. The retired key is
+// published for the overlap duration, the token expire duration by default.
+// The keys are kept in the stateFile over restart if it is not empty
+func (s *OAuthServer) EnableKeyRotation(interval time.Duration, overlap time.Duration, stateFile string) error {
+	if len(stateFile) > 0 {
+		if err := s.keyManager.SetStateFile(stateFile); err != nil {
+			return err
+		}
+	}
+	if overlap > 0 {
+		if overlap < s.tokenExpire {
+			log.Warn("The key rotation overlap ", overlap, " is less than the token expire ", s.tokenExpire)
+		}
+		s.keyManager.overlap = overlap
+	}
+	if err := s.keyManager.PrepareNextKey(); err != nil {
+		return err
+	}
+	if interval > 0 {
+		s.keyManager.StartRotation(interval)
+	}
+	return nil
+}
+
+// EnableJWKS publish the public keys of the signing keys as JWK set in
+// the jwksPath
+func (s *OAuthServer) EnableJWKS(jwksPath string) {
+	s.jwksPath = jwksPath
+	s.router.GET(jwksPath, s.HandleJWKS)
+}
+
+// HandleJWKS reply the JWK set which contains the public keys of the active,
+// next and not expired retired signing keys. The symmetric keys are never
+// published
+func (s *OAuthServer) HandleJWKS(c *gin.Context) {
+	keys := make([]jwk.Key, 0)
+	if isSymmetricAlgorithm(s.keyManager.GetAlgorithm()) {
+		c.JSON(http.StatusOK, gin.H{"keys": keys})
+		return
+	}
+	for _, key := range s.keyManager.GetPublishedKeys() {
+		k, err := createPublicJWK(key.Signer.Public(), key.KeyID, key.Signer.Algorithm())
+		if err != nil {
+			log.Error("Fail to create JWK with error:", err)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		keys = append(keys, k)
+	}
+	// jwk.Set is marshalled with "Keys" instead of the "keys" defined in RFC 7517
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+// EnableIntrospection enable the token introspection endpoint defined in RFC 7662
+// in the introspectPath. The caller is authenticated by the authenticator
+func (s *OAuthServer) EnableIntrospection(introspectPath string, authenticator *EndpointAuthenticator) {
+	verifier := s.createVerifier()
+	s.introspectionPath = introspectPath
+	s.introspectionAuthenticator = authenticator
+	s.router.POST(introspectPath, func(c *gin.Context) {
+		handleIntrospection(c, verifier, authenticator)
+	})
+}
+
+// SetNFProfileStore set the registered NF instances. If it is set, only
+// the registered NF service consumer can get the token for the registered
+// NF service producer
+func (s *OAuthServer) SetNFProfileStore(store *NFProfileStore) {
+	s.nfProfileStore = store
+}
+
+// SetAuthorizationPolicy set the policy evaluated before granting a token.
+// All the valid requests are granted if no policy is set
+func (s *OAuthServer) SetAuthorizationPolicy(policy *AuthorizationPolicy) {
+	s.policy = policy
+}
+
+// EnableClientAssertion enable the verification of the client credentials
+// assertion(CCA) with the public key in the NF profile of the consumer. The
+// CCA must be in every request if required is true. The CCA with a lifetime
+// longer than maxLifetime is rejected, DefaultClientAssertionMaxLifetime is
+// used if maxLifetime is 0
+func (s *OAuthServer) EnableClientAssertion(required bool, maxLifetime time.Duration) {
+	s.clientAssertionVerifier = NewClientAssertionVerifier([]string{"NRF", s.instanceID})
+	if maxLifetime > 0 {
+		s.clientAssertionVerifier.SetMaxLifetime(maxLifetime)
+	}
+	s.clientAssertionRequired = required
+}
+
+// EnableMutualTLS request and verify the client certificate with the CA
+// certificates in clientCAFile. The nfInstanceId and requesterFqdn in the
+// request must match the identity in the client certificate. If certificateBoundToken
+// is true, the token is bound to the client certificate as defined in RFC 8705
+func (s *OAuthServer) EnableMutualTLS(clientCAFile string, certificateBoundToken bool) {
+	s.clientCAFile = clientCAFile
+	s.certificateBoundToken = certificateBoundToken
+}
+
 // Start start the authorization server in the address
 func (s *OAuthServer) Start(addr string) error {
+	var handler http.Handler = s.router
 	if s.http2 {
 		log.Info("start http2 server")
-		h2s := &http2.Server{}
-		server := &http.Server{
-			Addr:    addr,
-			Handler: h2c.NewHandler(s.router, h2s),
-		}
-		if len(s.tlsCertFile) > 0 && len(s.tlsKeyFile) > 0 {
-			return server.ListenAndServeTLS(s.tlsCertFile, s.tlsKeyFile)
-		}
-		return server.ListenAndServe()
-
+		handler = h2c.NewHandler(s.router, &http2.Server{})
+	} else {
+		log.Info("start http server")
+	}
+	server := &http.Server{
+		Addr:    addr,
+		Handler: handler,
 	}
-	log.Info("start http server")
 	if len(s.tlsCertFile) > 0 && len(s.tlsKeyFile) > 0 {
-		return s.router.RunTLS(addr, s.tlsCertFile, s.tlsKeyFile)
+		if len(s.clientCAFile) > 0 {
+			clientCAs, err := loadClientCAs(s.clientCAFile)
+			if err != nil {
+				return err
+			}
+			log.Info("enable mTLS with client CA file ", s.clientCAFile)
+			server.TLSConfig = &tls.Config{ClientCAs: clientCAs, ClientAuth: tls.RequireAndVerifyClientCert}
+		}
+		return server.ListenAndServeTLS(s.tlsCertFile, s.tlsKeyFile)
+	} else if len(s.clientCAFile) > 0 {
+		return fmt.Errorf("mTLS can't be enabled without tlsCertFile and tlsKeyFile")
 	}
-	return s.router.Run(addr)
+	return server.ListenAndServe()
 }
 
 // HandleTokenRequest handle the AccessTokenRequest from the client
@@ -95,74 +271,346 @@ func (s *OAuthServer) HandleTokenRequest(c *gin.Context) {
 	err = art.FromX3WFormEncoding(bytes.NewBuffer(b))
 	if err != nil {
 		log.Error("Fail to decode request with error:", err)
-		c.Status(http.StatusBadRequest)
+		c.JSON(http.StatusBadRequest, NewInvalidRequestError("malformed request: %v", err))
 		return
 	}
 
-	token, accessTokenErr := s.createToken(art)
+	var clientCert *x509.Certificate
+	peerPlmnConsumer := s.isPeerPlmnConsumer(c.Request, art)
+	noCache := isNoCacheRequest(c.Request)
+	if peerPlmnConsumer {
+		// the consumer is authenticated by the authorization server of its PLMN
+		log.Info("Accept the token request from ", art.NfInstanceID, " in the peer PLMN ", art.RequesterPlmn)
+	} else {
+		var accessTokenErr *AccessTokenError
+		clientCert, accessTokenErr = s.checkClientCertificate(c, art)
+		if accessTokenErr != nil {
+			c.JSON(http.StatusBadRequest, accessTokenErr)
+			return
+		}
+		if accessTokenErr = s.authenticateClient(art); accessTokenErr != nil {
+			c.JSON(http.StatusBadRequest, accessTokenErr)
+			return
+		}
+	}
+	if s.isRoamingRequest(art) {
+		s.forwardRoamingRequest(c, art, b, noCache)
+		return
+	}
+	if s.parentClient != nil && !s.canServeLocally(art) {
+		s.delegateTokenRequest(c, art, b, peerPlmnConsumer, noCache)
+		return
+	}
+	var certThumbprint string
+	if clientCert != nil && s.certificateBoundToken {
+		certThumbprint = GetCertificateThumbprint(clientCert)
+	}
+	token, expireTime, accessTokenErr := s.issueToken(art, certThumbprint, peerPlmnConsumer, noCache)
 	if accessTokenErr != nil {
 		c.JSON(http.StatusBadRequest, accessTokenErr)
 		return
 	}
-	resp := AccessTokenResponse{
+	replyTokenResponse(c, &AccessTokenResponse{
 		AccessToken: token,
 		TokenType:   "Bearer",
-		ExpiresIn:   s.getTokenExpireTime().Unix(),
+		ExpiresIn:   getExpiresIn(expireTime),
 		Scope:       art.Scope,
+	})
+}
+
+// isNoCacheRequest return true if the client asks for a new token instead of
+// the cached one with "Cache-Control: no-cache", for example its cached token
+// is rejected by the producer
+func isNoCacheRequest(r *http.Request) bool {
+	for _, directive := range strings.Split(r.Header.Get("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-cache") {
+			return true
+		}
 	}
+	return false
+}
+
+// replyTokenResponse reply the AccessTokenResponse which must not be cached
+func replyTokenResponse(c *gin.Context, resp *AccessTokenResponse) {
 	c.Header("Cache-Control", "no-store")
 	c.Header("Pragma", "no-cache")
-	c.JSON(http.StatusOK, &resp)
+	c.JSON(http.StatusOK, resp)
+}
+
+// checkClientCertificate check if the nfInstanceId and the requesterFqdn in the request
+// match the identity in the client certificate if mTLS is enabled. The identity is:
+// - the NF instance id in the URI SAN "urn:uuid:<nfInstanceId>", or
+// - the FQDN in the DNS SAN if no NF instance id in URI SAN, it must match the
+// FQDN in the registered NF profile of the nfInstanceId
+func (s *OAuthServer) checkClientCertificate(c *gin.Context, art *AccessTokenRequest) (*x509.Certificate, *AccessTokenError) {
+	if len(s.clientCAFile) <= 0 {
+		return nil, nil
+	}
+	if c.Request.TLS == nil || len(c.Request.TLS.PeerCertificates) <= 0 {
+		log.Error("No client certificate from ", art.NfInstanceID)
+		return nil, NewAccessTokenError(InvalidClient)
+	}
+	cert := c.Request.TLS.PeerCertificates[0]
+	if accessTokenErr := s.checkCertificateIdentity(cert, art); accessTokenErr != nil {
+		return nil, accessTokenErr
+	}
+	return cert, nil
+}
+
+func (s *OAuthServer) checkCertificateIdentity(cert *x509.Certificate, art *AccessTokenRequest) *AccessTokenError {
+	if len(art.RequesterFqdn) > 0 && !IsCertificateForFqdn(cert, art.RequesterFqdn) {
+		log.Error("The requesterFqdn ", art.RequesterFqdn, " does not match the client certificate")
+		return NewAccessTokenError(InvalidClient)
+	}
+	if len(GetCertificateNfInstanceIDs(cert)) > 0 {
+		if !IsCertificateForNfInstance(cert, art.NfInstanceID) {
+			log.Error("The nfInstanceId ", art.NfInstanceID, " does not match the client certificate")
+			return NewAccessTokenError(InvalidClient)
+		}
+		return nil
+	}
+	// identify the client by the FQDN of the registered NF profile, the
+	// requesterFqdn is chosen by the client and can't identify it
+	if s.nfProfileStore != nil {
+		if profile, ok := s.nfProfileStore.GetProfile(art.NfInstanceID); ok && len(profile.Fqdn) > 0 && IsCertificateForFqdn(cert, profile.Fqdn) {
+			return nil
+		}
+	}
+	log.Error("Fail to identify ", art.NfInstanceID, " by the client certificate")
+	return NewAccessTokenError(InvalidClient)
 }
 
-func (s *OAuthServer) getTokenFromCache(art *AccessTokenRequest) (string, error) {
-	if art.IsRequestByType() {
-		key := fmt.Sprintf("%s-%s", art.NfType, art.TargetNfType)
+// authenticateClient verify the client credentials assertion in the request
+// if the verification is enabled
+func (s *OAuthServer) authenticateClient(art *AccessTokenRequest) *AccessTokenError {
+	if s.clientAssertionVerifier == nil {
+		return nil
+	}
+	if len(art.ClientAssertion) <= 0 {
+		if s.clientAssertionRequired {
+			log.Error("Missing client_assertion from ", art.NfInstanceID)
+			return NewAccessTokenError(InvalidClient)
+		}
+		return nil
+	}
+	if art.ClientAssertionType != ClientAssertionTypeJWTBearer {
+		log.Error("Unsupported client_assertion_type ", art.ClientAssertionType)
+		return NewAccessTokenError(InvalidClient)
+	}
+	if s.nfProfileStore == nil {
+		log.Error("No NF profiles configured to verify the client_assertion")
+		return NewAccessTokenError(InvalidClient)
+	}
+	profile, ok := s.nfProfileStore.GetProfile(art.NfInstanceID)
+	if !ok || len(profile.ClientPublicKey) <= 0 {
+		log.Error("No public key registered for ", art.NfInstanceID, " to verify the client_assertion")
+		return NewAccessTokenError(InvalidClient)
+	}
+	key, err := loadSignatureKey([]byte(profile.ClientPublicKey))
+	if err != nil {
+		log.Error("Fail to load the public key of ", art.NfInstanceID, " with error:", err)
+		return NewAccessTokenError(InvalidClient)
+	}
+	if err = s.clientAssertionVerifier.Verify(art.ClientAssertion, art.NfInstanceID, key); err != nil {
+		log.Error("Fail to verify the client_assertion from ", art.NfInstanceID, " with error:", err)
+		return NewAccessTokenError(InvalidClient)
+	}
+	return nil
+}
+
+// getTokenCacheKey get the key of the cached token for the request, the
+// token bound to the client certificate is cached with the certThumbprint
+func (s *OAuthServer) getTokenCacheKey(art *AccessTokenRequest, certThumbprint string) (string, bool) {
+	key, ok := art.GetTokenCacheKey()
+	if ok && len(certThumbprint) > 0 {
+		key += "#" + certThumbprint
+	}
+	return key, ok
+}
+
+func (s *OAuthServer) getTokenFromCache(art *AccessTokenRequest, certThumbprint string) (string, error) {
+	if key, ok := s.getTokenCacheKey(art, certThumbprint); ok {
 		return s.tokenCache.GetToken(key)
 	}
 	return "", fmt.Errorf("Fail to get token")
 
 }
 
-func (s *OAuthServer) cacheTokenFor(art *AccessTokenRequest, expireTime int64, token string) {
-	if art.IsRequestByType() {
-		key := fmt.Sprintf("%s-%s", art.NfType, art.TargetNfType)
+func (s *OAuthServer) cacheTokenFor(art *AccessTokenRequest, certThumbprint string, expireTime int64, token string) {
+	if key, ok := s.getTokenCacheKey(art, certThumbprint); ok {
 		s.tokenCache.CacheToken(key, expireTime, token)
 	}
 }
 
+// checkTargetNfInstance check if the target NF service producer instance
+// is registered and its NF type matches the targetNfType if it is present
+func (s *OAuthServer) checkTargetNfInstance(art *AccessTokenRequest) *AccessTokenError {
+	if s.nfProfileStore == nil {
+		log.Error("No NF profiles configured to check the targetNfInstanceId ", art.TargetNfInstanceID)
+		return NewAccessTokenError(InvalidRequest)
+	}
+	profile, ok := s.nfProfileStore.GetProfile(art.TargetNfInstanceID)
+	if !ok {
+		log.Error("The targetNfInstanceId ", art.TargetNfInstanceID, " is not registered")
+		return NewAccessTokenError(InvalidRequest)
+	}
+	if len(art.TargetNfType) > 0 && art.TargetNfType != profile.NfType {
+		log.Error("The targetNfType ", art.TargetNfType, " does not match the type ", profile.NfType, " of instance ", art.TargetNfInstanceID)
+		return NewAccessTokenError(InvalidRequest)
+	}
+	return nil
+}
+
 func (s *OAuthServer) createToken(art *AccessTokenRequest) (string, *AccessTokenError) {
+	return s.createBoundToken(art, "")
+}
+
+// createBoundToken create a token bound to the client certificate with the
+// certThumbprint. The token is not bound if the certThumbprint is empty
+func (s *OAuthServer) createBoundToken(art *AccessTokenRequest, certThumbprint string) (string, *AccessTokenError) {
+	t, _, accessTokenErr := s.issueToken(art, certThumbprint, false, false)
+	return t, accessTokenErr
+}
+
+// issueToken create a bound token like createBoundToken and return the token
+// with its expire time. The peerPlmnConsumer is true if the request is
+// forwarded and authenticated by the peer PLMN of the consumer. A new token is
+// created without looking up the token cache if noCache is true
+func (s *OAuthServer) issueToken(art *AccessTokenRequest, certThumbprint string, peerPlmnConsumer bool, noCache bool) (string, int64, *AccessTokenError) {
 	b, _ := art.ToJSON()
 	log.Info("create token from AccessTokenRequest:", string(b))
 	accessTokenErr := art.CheckValid()
 	if accessTokenErr != nil {
-		return "", accessTokenErr
+		return "", 0, accessTokenErr
 	}
-	t, err := s.getTokenFromCache(art)
-	if err == nil {
-		return t, nil
+	accessTokenErr = s.authorizeRequest(art, peerPlmnConsumer)
+	if accessTokenErr != nil {
+		return "", 0, accessTokenErr
+	}
+	if key, ok := s.getTokenCacheKey(art, certThumbprint); ok && !noCache {
+		if t, expireTime, err := s.tokenCache.GetTokenWithExpireTime(key); err == nil {
+			// the token issued in the same second as a revocation, or before
+			// a future revokedBefore, is cached after the cache is cleared
+			if _, err = s.createVerifier().VerifyTokenClaims([]byte(t)); err == nil {
+				return t, expireTime, nil
+			}
+			log.Warn("Remove the cached token of ", art.NfInstanceID, " with error:", err)
+			s.tokenCache.RemoveToken(key)
+		}
 	}
 	claims, accessTokenErr := s.createClaims(art)
 	if accessTokenErr != nil {
-		return "", accessTokenErr
+		return "", 0, accessTokenErr
+	}
+	if len(certThumbprint) > 0 {
+		claims.Cnf = &Confirmation{X5tS256: certThumbprint}
 	}
 	token := claims.ToJwtToken()
-	payload, err := jwt.Sign(token, s.alg, s.key)
+	signingKey := s.keyManager.GetActiveKey()
+	t, err := signJWT(token, signingKey.Signer, signingKey.KeyID)
 	if err != nil {
 		log.Error("Fail to create JWT Token with error:", err)
-		return "", NewAccessTokenError(InvalidRequest)
+		return "", 0, NewAccessTokenError(InvalidRequest)
 	}
-	t = string(payload)
-	s.cacheTokenFor(art, claims.Exp, t)
-	return t, nil
+	s.cacheTokenFor(art, certThumbprint, claims.Exp, t)
+	return t, claims.Exp, nil
 }
 
-func (s *OAuthServer) createClaims(art *AccessTokenRequest) (*AccessTokenClaims, *AccessTokenError) {
-	if !art.IsRequestByType() {
-		log.Error("create token only with nfType and targetNfType")
-		return nil, NewAccessTokenError(InvalidRequest)
+// authorizeRequest check if the token can be granted for the request. The scope
+// of the request may be narrowed to the granted scope. It must be called before
+// looking up the token cache
+func (s *OAuthServer) authorizeRequest(art *AccessTokenRequest, peerPlmnConsumer bool) *AccessTokenError {
+	if art.IsRequestByInstance() {
+		if accessTokenErr := s.checkTargetNfInstance(art); accessTokenErr != nil {
+			return accessTokenErr
+		}
+	} else if !art.IsRequestByType() {
+		log.Error("create token only with nfType and targetNfType or with targetNfInstanceId")
+		return NewAccessTokenError(InvalidRequest)
 	}
+	consumerNfType := art.NfType
+	targetNfType := art.TargetNfType
+	if s.nfProfileStore != nil {
+		consumer, accessTokenErr := s.checkConsumer(art, peerPlmnConsumer)
+		if accessTokenErr != nil {
+			return accessTokenErr
+		}
+		if accessTokenErr = s.checkTargetNfType(art, consumer.NfType); accessTokenErr != nil {
+			return accessTokenErr
+		}
+		consumerNfType = consumer.NfType
+		if art.IsRequestByInstance() {
+			producer, _ := s.nfProfileStore.GetProfile(art.TargetNfInstanceID)
+			targetNfType = producer.NfType
+		}
+	}
+	if s.policy != nil {
+		scope, accessTokenErr := s.policy.Evaluate(art, consumerNfType, targetNfType)
+		if accessTokenErr != nil {
+			return accessTokenErr
+		}
+		// narrow the requested scope to the granted one
+		art.Scope = scope
+	}
+	return nil
+}
+
+// checkForwardedRequest check the request before it is forwarded to other
+// authorization server, which trusts the consumer authenticated by this server
+func (s *OAuthServer) checkForwardedRequest(art *AccessTokenRequest, peerPlmnConsumer bool) *AccessTokenError {
+	if accessTokenErr := art.CheckValid(); accessTokenErr != nil {
+		return accessTokenErr
+	}
+	if s.nfProfileStore != nil {
+		if _, accessTokenErr := s.checkConsumer(art, peerPlmnConsumer); accessTokenErr != nil {
+			return accessTokenErr
+		}
+	}
+	return nil
+}
+
+// checkConsumer check if the NF service consumer is registered. The consumer
+// in a peer PLMN is not registered and its nfType in the request is used
+func (s *OAuthServer) checkConsumer(art *AccessTokenRequest, peerPlmnConsumer bool) (*NFProfile, *AccessTokenError) {
+	if peerPlmnConsumer {
+		return &NFProfile{NfInstanceID: art.NfInstanceID, NfType: art.NfType}, nil
+	}
+	profile, ok := s.nfProfileStore.GetProfile(art.NfInstanceID)
+	if !ok || !profile.IsRegistered() {
+		log.Error("The NF service consumer ", art.NfInstanceID, " is not registered")
+		return nil, NewAccessTokenError(InvalidClient)
+	}
+	if len(art.NfType) > 0 && art.NfType != profile.NfType {
+		log.Error("The nfType ", art.NfType, " does not match the type ", profile.NfType, " of consumer ", art.NfInstanceID)
+		return nil, NewAccessTokenError(InvalidClient)
+	}
+	return profile, nil
+}
 
+// checkTargetNfType check if the NF service producer with targetNfType is registered
+// and it allows the access from the NF service consumer
+func (s *OAuthServer) checkTargetNfType(art *AccessTokenRequest, consumerNfType string) *AccessTokenError {
+	var producers []*NFProfile
+	if art.IsRequestByInstance() {
+		profile, _ := s.nfProfileStore.GetProfile(art.TargetNfInstanceID)
+		producers = []*NFProfile{profile}
+	} else {
+		producers = s.nfProfileStore.GetProfilesByNfType(art.TargetNfType)
+	}
+	if len(producers) <= 0 {
+		log.Error("No NF service producer with type ", art.TargetNfType, " is registered")
+		return NewAccessTokenError(UnauthorizedClient)
+	}
+	for _, producer := range producers {
+		if producer.IsNfTypeAllowed(consumerNfType) {
+			return nil
+		}
+	}
+	log.Error("The NF service producer ", art.TargetNfType, " does not allow the access from ", consumerNfType)
+	return NewAccessTokenError(UnauthorizedClient)
+}
+
+func (s *OAuthServer) createClaims(art *AccessTokenRequest) (*AccessTokenClaims, *AccessTokenError) {
 	atc := NewAccessTokenClaims()
 	atc.Iss = s.instanceID
 	atc.Sub = art.NfInstanceID
@@ -174,12 +622,22 @@ func (s *OAuthServer) createClaims(art *AccessTokenRequest) (*AccessTokenClaims,
 
 	atc.Scope = art.Scope
 	atc.Exp = s.getTokenExpireTime().Unix()
+	atc.Iat = time.Now().Unix()
+	atc.Nbf = atc.Iat
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		log.Error("Fail to create jti with error:", err)
+		return nil, NewAccessTokenError(InvalidRequest)
+	}
+	atc.Jti = hex.EncodeToString(jti)
 	if art.RequesterPlmn != nil {
 		atc.ConsumerPlmnID = art.RequesterPlmn
 	}
 	if art.TargetPlmn != nil {
 		atc.ProducerPlmnID = art.TargetPlmn
 	}
+	atc.ConsumerSnpnID = art.GetRequesterSnpn()
+	atc.ProducerSnpnID = art.TargetSnpn
 	if art.TargetSnssaiList != nil {
 		atc.ProducerSnssaiList = art.TargetSnssaiList
 	}
@@ -194,3 +652,22 @@ func (s *OAuthServer) createClaims(art *AccessTokenRequest) (*AccessTokenClaims,
 func (s *OAuthServer) getTokenExpireTime() time.Time {
 	return time.Now().Add(s.tokenExpire)
 }
+
+// getExpiresIn get the lifetime in seconds of the token defined in RFC 6749
+// from its expire time
+func getExpiresIn(expireTime int64) int64 {
+	expiresIn := expireTime - time.Now().Unix()
+	if expiresIn < 0 {
+		return 0
+	}
+	return expiresIn
+}
+
+// getGrantedScope get the scope granted in the token response, it is the
+// requested scope if the scope is omitted as defined in RFC 6749 section 5.1
+func getGrantedScope(resp *AccessTokenResponse, art *AccessTokenRequest) string {
+	if len(resp.Scope) <= 0 {
+		return art.Scope
+	}
+	return resp.Scope
+}
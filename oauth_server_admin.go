@@ -0,0 +1,130 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// EnableAdminAPI enable the administration REST API under the adminPath. The
+// caller is authenticated by the authenticator. The following NF profile
+// management API is provided:
+// - GET <adminPath>/nf-instances list all the NF profiles
+// - GET <adminPath>/nf-instances/:nfInstanceId get a NF profile
+// - PUT <adminPath>/nf-instances/:nfInstanceId add or update a NF profile
+// - DELETE <adminPath>/nf-instances/:nfInstanceId delete a NF profile
+//
+// and the signing key management API:
+// - GET <adminPath>/keys list the kid and state of the signing keys
+// - POST <adminPath>/keys/rotate rotate the signing key
+//
+// and the token revocation API, the caller is authenticated by the
+// authenticator of the revocation endpoint if it is enabled:
+// - GET <adminPath>/revocations get the revocation list
+// - POST <adminPath>/revocations revoke the tokens with RevocationRequest
+func (s *OAuthServer) EnableAdminAPI(adminPath string, authenticator *EndpointAuthenticator) {
+	if s.nfProfileStore == nil {
+		s.nfProfileStore = NewNFProfileStore()
+	}
+	s.adminAuthenticator = authenticator
+	group := s.router.Group(adminPath, func(c *gin.Context) {
+		if !authenticateEndpoint(c, authenticator, "admin") {
+			c.Abort()
+		}
+	})
+	group.GET("/nf-instances", s.handleListNFProfiles)
+	group.GET("/nf-instances/:nfInstanceId", s.handleGetNFProfile)
+	group.PUT("/nf-instances/:nfInstanceId", s.handlePutNFProfile)
+	group.DELETE("/nf-instances/:nfInstanceId", s.handleDeleteNFProfile)
+	group.GET("/keys", s.handleListSigningKeys)
+	group.POST("/keys/rotate", s.handleRotateSigningKey)
+	revocations := s.router.Group(adminPath+"/revocations", func(c *gin.Context) {
+		// the clients of the revocation endpoint can revoke their own tokens
+		if s.revocationAuthenticator != nil && s.revocationAuthenticator.Authenticate(c.Request) {
+			return
+		}
+		if !authenticateEndpoint(c, authenticator, "revocation") {
+			c.Abort()
+		}
+	})
+	revocations.GET("", s.handleListRevocations)
+	revocations.POST("", s.handleRevoke)
+}
+
+func (s *OAuthServer) handleListNFProfiles(c *gin.Context) {
+	c.JSON(http.StatusOK, s.nfProfileStore.GetProfiles())
+}
+
+func (s *OAuthServer) handleGetNFProfile(c *gin.Context) {
+	profile, ok := s.nfProfileStore.GetProfile(c.Param("nfInstanceId"))
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, profile)
+}
+
+func (s *OAuthServer) handlePutNFProfile(c *gin.Context) {
+	profile := &NFProfile{}
+	if err := c.ShouldBindJSON(profile); err != nil {
+		log.Error("Fail to decode NF profile with error:", err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	nfInstanceID := c.Param("nfInstanceId")
+	if len(profile.NfInstanceID) <= 0 {
+		profile.NfInstanceID = nfInstanceID
+	} else if profile.NfInstanceID != nfInstanceID {
+		log.Error("The nfInstanceId ", profile.NfInstanceID, " in NF profile does not match ", nfInstanceID)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	replaced, err := s.nfProfileStore.AddProfile(profile)
+	if err != nil {
+		log.Error("Fail to add NF profile with error:", err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	log.Info("NF profile ", nfInstanceID, " is added or updated")
+	if replaced {
+		c.JSON(http.StatusOK, profile)
+	} else {
+		c.JSON(http.StatusCreated, profile)
+	}
+}
+
+func (s *OAuthServer) handleDeleteNFProfile(c *gin.Context) {
+	nfInstanceID := c.Param("nfInstanceId")
+	if !s.nfProfileStore.RemoveProfile(nfInstanceID) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	log.Info("NF profile ", nfInstanceID, " is deleted")
+	c.Status(http.StatusNoContent)
+}
+
+func (s *OAuthServer) handleListSigningKeys(c *gin.Context) {
+	type keyInfo struct {
+		KeyID     string `json:"kid"`
+		State     string `json:"state"`
+		RetiredAt int64  `json:"retiredAt,omitempty"`
+	}
+	keys := make([]*keyInfo, 0)
+	for _, key := range s.keyManager.GetPublishedKeys() {
+		info := &keyInfo{KeyID: key.KeyID, State: key.State}
+		if key.State == SigningKeyRetired {
+			info.RetiredAt = key.RetiredAt.Unix()
+		}
+		keys = append(keys, info)
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+func (s *OAuthServer) handleRotateSigningKey(c *gin.Context) {
+	if err := s.keyManager.Rotate(); err != nil {
+		log.Error("Fail to rotate the signing key with error:", err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	s.handleListSigningKeys(c)
+}
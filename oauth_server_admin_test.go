@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/lestrrat-go/jwx/jwa"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminAPIAuthentication(t *testing.T) {
+	key, _ := loadSignatureKey([]byte(privateKey))
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	server.EnableAdminAPI("/admin", NewEndpointAuthenticator(map[string]string{"admin": "admin-secret"}, false))
+
+	putProfile := func(clientID string, secret string) int {
+		req := httptest.NewRequest(http.MethodPut, "/admin/nf-instances/5a7bd676-ceeb-44bb-95e0-f6a55a312345", strings.NewReader(`{"nfType":"AMF"}`))
+		if len(clientID) > 0 {
+			req.SetBasicAuth(clientID, secret)
+		}
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := putProfile("", ""); code != http.StatusUnauthorized {
+		t.Error("The unauthenticated caller should be rejected ", code)
+	}
+	if code := putProfile("admin", "wrong-secret"); code != http.StatusUnauthorized {
+		t.Error("The caller with wrong secret should be rejected ", code)
+	}
+	if _, ok := server.nfProfileStore.GetProfile("5a7bd676-ceeb-44bb-95e0-f6a55a312345"); ok {
+		t.Fatal("The NF profile should not be added by the unauthenticated caller")
+	}
+	if code := putProfile("admin", "admin-secret"); code != http.StatusCreated {
+		t.Error("The authenticated caller should add the NF profile ", code)
+	}
+
+	for _, path := range []string{"/admin/nf-instances", "/admin/keys", "/admin/revocations"} {
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusUnauthorized {
+			t.Error("The unauthenticated request to ", path, " should be rejected")
+		}
+	}
+
+	server = NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	server.EnableAdminAPI("/admin", NewEndpointAuthenticator(nil, false))
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/keys/rotate", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Error("All the callers should be rejected without authentication method")
+	}
+}
+
+func TestAdminAPIClientCertificate(t *testing.T) {
+	key, _ := loadSignatureKey([]byte(privateKey))
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	config := &EndpointConfig{AllowClientCertificate: true, Fqdns: []string{"oam.example.com"}}
+	authenticator, err := config.CreateAuthenticator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.EnableAdminAPI("/admin", authenticator)
+
+	listProfiles := func(fqdn string) int {
+		cert, err := createTestCertificate([]string{"urn:uuid:974eaf3a-175e-11eb-bf74-bb1f819f224d"}, []string{fqdn})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/admin/nf-instances", nil)
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := listProfiles("amf.example.com"); code != http.StatusUnauthorized {
+		t.Error("The NF with a certificate of other FQDN should not be an administrator ", code)
+	}
+	if code := listProfiles("oam.example.com"); code != http.StatusOK {
+		t.Error("The administrator with the certificate of the FQDN should be accepted ", code)
+	}
+}
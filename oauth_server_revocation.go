@@ -0,0 +1,146 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RevocationRequest the request of the administration REST API to revoke
+// the tokens by jti, by subject or by the issued time
+type RevocationRequest struct {
+	// the jti of the revoked token
+	Jti string `json:"jti,omitempty"`
+	// the expiration time of the revoked token, the token expire duration
+	// from now by default
+	Exp int64 `json:"exp,omitempty"`
+	// revoke all the tokens issued to the NF instance
+	Sub string `json:"sub,omitempty"`
+	// revoke all the tokens issued before or at the time, now by default if
+	// sub is set
+	Before int64 `json:"before,omitempty"`
+}
+
+// createVerifier create a verifier of the tokens issued by this server
+func (s *OAuthServer) createVerifier() *AccessTokenVerifier {
+	verifier := NewAccessTokenVerifierWithKeySource(s.keyManager.GetAlgorithm(), s.keyManager)
+	verifier.SetRevocationList(s.revocationList)
+	return verifier
+}
+
+// GetRevocationList get the revoked tokens
+func (s *OAuthServer) GetRevocationList() *RevocationList {
+	return s.revocationList
+}
+
+// EnableRevocation enable the token revocation endpoint defined in RFC 7009 in
+// the revokePath. The revocation list can be pulled by the proxies with GET
+// request in the same path. The caller is authenticated by the authenticator
+func (s *OAuthServer) EnableRevocation(revokePath string, authenticator *EndpointAuthenticator) {
+	verifier := s.createVerifier()
+	s.revocationPath = revokePath
+	s.revocationAuthenticator = authenticator
+	s.router.POST(revokePath, func(c *gin.Context) {
+		if !authenticateEndpoint(c, authenticator, "revocation") {
+			return
+		}
+		token := c.PostForm("token")
+		if len(token) <= 0 {
+			c.JSON(http.StatusBadRequest, NewAccessTokenError(InvalidRequest))
+			return
+		}
+		// the invalid, expired or already revoked token is ignored as
+		// defined in RFC 7009
+		if claims, err := verifier.VerifyTokenClaims([]byte(token)); err == nil && len(claims.Jti) > 0 {
+			// only the token issued to the caller can be revoked as defined
+			// in RFC 7009 section 2.1, except by the administrator
+			if !s.isAdminCaller(c.Request) && !isIssuedToCaller(c.Request, claims.Sub) {
+				log.Error("The token ", claims.Jti, " of ", claims.Sub, " is not issued to the caller")
+				c.JSON(http.StatusBadRequest, NewAccessTokenError(UnauthorizedClient))
+				return
+			}
+			log.Info("Revoke the token ", claims.Jti, " of ", claims.Sub)
+			s.revocationList.RevokeToken(claims.Jti, claims.Exp)
+		}
+		c.Status(http.StatusOK)
+	})
+	s.router.GET(revokePath, func(c *gin.Context) {
+		if !authenticateEndpoint(c, authenticator, "revocation") {
+			return
+		}
+		c.JSON(http.StatusOK, s.revocationList.GetData())
+	})
+}
+
+// AddRevocationSubscriber push the revocation list to the pushURL of a proxy
+// with the client whenever the revocation list is changed
+func (s *OAuthServer) AddRevocationSubscriber(client *OAuthClient, pushURL string) {
+	s.revocationList.AddListener(func(data *RevocationListData) {
+		b, err := toJSONBytes(data)
+		if err != nil {
+			return
+		}
+		go func() {
+			if _, err := client.Post(pushURL, "application/json", b); err != nil {
+				log.Error("Fail to push the revocation list to ", pushURL, " with error:", err)
+			}
+		}()
+	})
+}
+
+// isAdminCaller return true if the caller is authenticated as the administrator
+func (s *OAuthServer) isAdminCaller(r *http.Request) bool {
+	return s.adminAuthenticator != nil && s.adminAuthenticator.Authenticate(r)
+}
+
+// isIssuedToCaller return true if the authenticated caller is the NF instance
+// nfInstanceID, identified by the client id of the Basic authentication or the
+// NF instance id in the verified client certificate
+func isIssuedToCaller(r *http.Request, nfInstanceID string) bool {
+	if clientID, _, ok := r.BasicAuth(); ok {
+		return strings.EqualFold(clientID, nfInstanceID)
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return IsCertificateForNfInstance(r.TLS.PeerCertificates[0], nfInstanceID)
+	}
+	return false
+}
+
+func (s *OAuthServer) handleListRevocations(c *gin.Context) {
+	c.JSON(http.StatusOK, s.revocationList.GetData())
+}
+
+func (s *OAuthServer) handleRevoke(c *gin.Context) {
+	req := &RevocationRequest{}
+	if err := c.BindJSON(req); err != nil {
+		return
+	}
+	// the caller other than the administrator can only revoke its own tokens
+	if !s.isAdminCaller(c.Request) && (len(req.Jti) > 0 || !isIssuedToCaller(c.Request, req.Sub)) {
+		log.Error("The caller is not allowed to revoke the tokens by jti:", req.Jti, ",sub:", req.Sub, ",before:", req.Before)
+		c.Status(http.StatusForbidden)
+		return
+	}
+	now := time.Now().Unix()
+	switch {
+	case len(req.Jti) > 0:
+		if req.Exp <= 0 {
+			req.Exp = now + int64(s.tokenExpire.Seconds())
+		}
+		s.revocationList.RevokeToken(req.Jti, req.Exp)
+	case len(req.Sub) > 0:
+		if req.Before <= 0 {
+			req.Before = now
+		}
+		s.revocationList.RevokeSubject(req.Sub, req.Before)
+	case req.Before > 0:
+		s.revocationList.RevokeBefore(req.Before)
+	default:
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	log.Info("Revoke the tokens by jti:", req.Jti, ",sub:", req.Sub, ",before:", req.Before)
+	c.JSON(http.StatusOK, s.revocationList.GetData())
+}
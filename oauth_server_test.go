@@ -3,6 +3,9 @@ package main
 import (
 	"fmt"
 	"github.com/lestrrat-go/jwx/jwa"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -41,14 +44,18 @@ func createToken() (string, error) {
 		return "", err
 	}
 	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	return createTokenWithServer(server)
+}
+
+func createTokenWithServer(server *OAuthServer) (string, error) {
 	req := NewAccessTokenRequest()
 	req.GrantType = "client_credentials"
-	req.NfInstanceID = "12345"
+	req.NfInstanceID = "5a7bd676-ceeb-44bb-95e0-f6a55a312345"
 	req.NfType = "LMF"
 	req.TargetNfType = "AMF"
 	req.Scope = "namf-comm"
 	req.TargetNsiList = []string{"nsi-1", "nsi-2", "nsi-3"}
-	req.TargetSnssaiList = []*Snssai{&Snssai{Sst: 10}, &Snssai{Sst: 30, Sd: "sd-2"}}
+	req.TargetSnssaiList = []*Snssai{&Snssai{Sst: 10}, &Snssai{Sst: 30, Sd: "000002"}}
 	token, accessTokenErr := server.createToken(req)
 	if accessTokenErr != nil {
 		return "", fmt.Errorf(accessTokenErr.Error)
@@ -64,3 +71,201 @@ func TestClaims(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestCreateTokenByInstance(t *testing.T) {
+	key, err := loadSignatureKey([]byte(privateKey))
+	if err != nil {
+		t.Fail()
+	}
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	store := NewNFProfileStore()
+	store.AddProfile(&NFProfile{NfInstanceID: "8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001", NfType: "AMF"})
+	store.AddProfile(&NFProfile{NfInstanceID: "5a7bd676-ceeb-44bb-95e0-f6a55a312345", NfType: "LMF"})
+	server.SetNFProfileStore(store)
+	req := NewAccessTokenRequest()
+	req.GrantType = "client_credentials"
+	req.NfInstanceID = "5a7bd676-ceeb-44bb-95e0-f6a55a312345"
+	req.TargetNfInstanceID = "8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001"
+	req.Scope = "namf-comm"
+	token, accessTokenErr := server.createToken(req)
+	if accessTokenErr != nil {
+		t.Fail()
+	}
+	if cached, err := server.getTokenFromCache(req, ""); err != nil || cached != token {
+		t.Fail()
+	}
+	claims, accessTokenErr := server.createClaims(req)
+	if accessTokenErr != nil || len(claims.Aud) != 1 || claims.Aud[0] != "8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001" {
+		t.Fail()
+	}
+
+	req.TargetNfInstanceID = "8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa002"
+	if _, accessTokenErr = server.createToken(req); accessTokenErr == nil {
+		t.Fail()
+	}
+	req.TargetNfInstanceID = "8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001"
+	req.TargetNfType = "UDM"
+	if _, accessTokenErr = server.createToken(req); accessTokenErr == nil {
+		t.Fail()
+	}
+}
+
+func TestCreateTokenWithSnpn(t *testing.T) {
+	key, _ := loadSignatureKey([]byte(privateKey))
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	req := NewAccessTokenRequest()
+	req.GrantType = "client_credentials"
+	req.NfInstanceID = "5a7bd676-ceeb-44bb-95e0-f6a55a312345"
+	req.NfType = "AMF"
+	req.TargetNfType = "UDM"
+	req.Scope = "nudm-sdm"
+	req.RequesterSnpnList = []*PlmnIDNid{&PlmnIDNid{Mcc: "460", Mnc: "00", Nid: "000007ed9d5"}}
+	req.TargetSnpn = &PlmnIDNid{Mcc: "460", Mnc: "01", Nid: "000007ed9d6"}
+	token, accessTokenErr := server.createToken(req)
+	if accessTokenErr != nil {
+		t.Fatal(accessTokenErr.Error)
+	}
+	claims, err := server.createVerifier().VerifyTokenClaims([]byte(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !req.RequesterSnpnList[0].Equal(claims.ConsumerSnpnID) || !req.TargetSnpn.Equal(claims.ProducerSnpnID) {
+		t.Error("The SNPNs of the consumer and producer should be in the token")
+	}
+}
+
+func TestTokenCacheKeyWithSnpn(t *testing.T) {
+	key, _ := loadSignatureKey([]byte(privateKey))
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	createToken := func(targetSnpn *PlmnIDNid) *AccessTokenClaims {
+		req := NewAccessTokenRequest()
+		req.GrantType = "client_credentials"
+		req.NfInstanceID = "5a7bd676-ceeb-44bb-95e0-f6a55a312345"
+		req.NfType = "AMF"
+		req.TargetNfType = "UDM"
+		req.Scope = "nudm-sdm"
+		req.TargetSnpn = targetSnpn
+		token, accessTokenErr := server.createToken(req)
+		if accessTokenErr != nil {
+			t.Fatal(accessTokenErr.Error)
+		}
+		claims, err := server.createVerifier().VerifyTokenClaims([]byte(token))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return claims
+	}
+	snpn1 := &PlmnIDNid{Mcc: "460", Mnc: "01", Nid: "000007ed9d6"}
+	snpn2 := &PlmnIDNid{Mcc: "460", Mnc: "01", Nid: "000007ed9d7"}
+	claims1 := createToken(snpn1)
+	claims2 := createToken(snpn2)
+	if !snpn1.Equal(claims1.ProducerSnpnID) || !snpn2.Equal(claims2.ProducerSnpnID) {
+		t.Error("The cached token of other targetSnpn should not be returned")
+	}
+	if claims := createToken(snpn1); claims.Jti != claims1.Jti {
+		t.Error("The token should be cached for the same targetSnpn")
+	}
+}
+
+func TestProxyTokenCacheKey(t *testing.T) {
+	key, _ := loadSignatureKey([]byte(privateKey))
+	pubKey, _ := loadSignatureKey([]byte(publicKey))
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	ts := httptest.NewServer(server.router)
+	defer ts.Close()
+	proxy := NewProxy("/reqtoken", "/verify", ts.URL+"/oauth2/token", nil, false, jwa.RS256, NewStaticKeySource(pubKey))
+	requestToken := func(targetPlmn *PlmnID, targetSnpn *PlmnIDNid) *AccessTokenClaims {
+		req := NewAccessTokenRequest()
+		req.GrantType = "client_credentials"
+		req.NfInstanceID = "5a7bd676-ceeb-44bb-95e0-f6a55a312345"
+		req.NfType = "AMF"
+		req.TargetNfType = "UDM"
+		req.Scope = "nudm-sdm"
+		req.TargetPlmn = targetPlmn
+		req.TargetSnpn = targetSnpn
+		resp, err := proxy.RequestToken(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := server.createVerifier().VerifyTokenClaims([]byte(resp.AccessToken))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return claims
+	}
+	plmn1 := &PlmnID{Mcc: "460", Mnc: "00"}
+	plmn2 := &PlmnID{Mcc: "460", Mnc: "01"}
+	if claims := requestToken(plmn1, nil); !plmn1.Equal(claims.ProducerPlmnID) {
+		t.Error("The token should be for the targetPlmn")
+	}
+	if claims := requestToken(plmn2, nil); !plmn2.Equal(claims.ProducerPlmnID) {
+		t.Error("The cached token of other targetPlmn should not be returned by the proxy")
+	}
+	snpn := &PlmnIDNid{Mcc: "460", Mnc: "01", Nid: "000007ed9d6"}
+	if claims := requestToken(plmn2, snpn); !snpn.Equal(claims.ProducerSnpnID) {
+		t.Error("The cached token of other targetSnpn should not be returned by the proxy")
+	}
+}
+
+func TestCreateTokenWithNFProfiles(t *testing.T) {
+	key, err := loadSignatureKey([]byte(privateKey))
+	if err != nil {
+		t.Fail()
+	}
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	store := NewNFProfileStore()
+	store.AddProfile(&NFProfile{NfInstanceID: "8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001", NfType: "AMF", AllowedNfTypes: []string{"LMF"}})
+	store.AddProfile(&NFProfile{NfInstanceID: "1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001", NfType: "LMF"})
+	store.AddProfile(&NFProfile{NfInstanceID: "4d5e6f70-8192-4a3b-8c4d-5e6f7081c001", NfType: "SMF"})
+	server.SetNFProfileStore(store)
+	req := NewAccessTokenRequest()
+	req.GrantType = "client_credentials"
+	req.NfInstanceID = "1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb001"
+	req.NfType = "LMF"
+	req.TargetNfType = "AMF"
+	req.Scope = "namf-comm"
+	if _, accessTokenErr := server.createToken(req); accessTokenErr != nil {
+		t.Fail()
+	}
+
+	req.NfInstanceID = "1b2c3d4e-5f60-4718-8a9b-0c1d2e3fb002"
+	if _, accessTokenErr := server.createToken(req); accessTokenErr == nil || accessTokenErr.Error != InvalidClient {
+		t.Fail()
+	}
+
+	req.NfInstanceID = "4d5e6f70-8192-4a3b-8c4d-5e6f7081c001"
+	req.NfType = "SMF"
+	if _, accessTokenErr := server.createToken(req); accessTokenErr == nil || accessTokenErr.Error != UnauthorizedClient {
+		t.Fail()
+	}
+
+	req.TargetNfType = "UDM"
+	req.Scope = "nudm-sdm"
+	if _, accessTokenErr := server.createToken(req); accessTokenErr == nil || accessTokenErr.Error != UnauthorizedClient {
+		t.Fail()
+	}
+}
+
+func TestTokenResponseExpiresIn(t *testing.T) {
+	key, _ := loadSignatureKey([]byte(privateKey))
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	ts := httptest.NewServer(server.router)
+	defer ts.Close()
+	pubKey, _ := loadSignatureKey([]byte(publicKey))
+	proxy := NewProxy("/reqtoken", "/verify", ts.URL+"/oauth2/token", nil, false, jwa.RS256, NewStaticKeySource(pubKey))
+
+	// the second response is from the token cache of the proxy
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/reqtoken", strings.NewReader(`{"grant_type":"client_credentials","nfInstanceId":"5a7bd676-ceeb-44bb-95e0-f6a55a312345","nfType":"LMF","targetNfType":"AMF","scope":"namf-comm"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		proxy.router.ServeHTTP(w, req)
+		resp := NewAccessTokenResponse()
+		if w.Code != http.StatusOK || resp.FromJSON(w.Body.Bytes()) != nil {
+			t.Fatal("Fail to get token ", w.Body.String())
+		}
+		if resp.ExpiresIn <= 3590 || resp.ExpiresIn > 3600 || len(resp.AccessToken) <= 0 {
+			t.Error("The expires_in should be the lifetime of the token ", w.Body.String())
+		}
+	}
+}
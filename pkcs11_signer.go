@@ -0,0 +1,209 @@
+//go:build pkcs11
+// +build pkcs11
+
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/asn1"
+	"fmt"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/miekg/pkcs11"
+	"io"
+	"math/big"
+	"sync"
+)
+
+// the DER encoded DigestInfo prefix of RSASSA-PKCS1-v1_5 defined in RFC 8017
+var pkcs1DigestInfoPrefix = map[crypto.Hash][]byte{
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+// the hash mechanism and the MGF of RSASSA-PSS for the hash function
+var pssMechanisms = map[crypto.Hash][2]uint{
+	crypto.SHA256: {pkcs11.CKM_SHA256, pkcs11.CKG_MGF1_SHA256},
+	crypto.SHA384: {pkcs11.CKM_SHA384, pkcs11.CKG_MGF1_SHA384},
+	crypto.SHA512: {pkcs11.CKM_SHA512, pkcs11.CKG_MGF1_SHA512},
+}
+
+// the DER encoded OID in CKA_EC_PARAMS of the named curves
+var ecCurves = map[string]elliptic.Curve{
+	"06082a8648ce3d030107": elliptic.P256(),
+	"06052b81040022":       elliptic.P384(),
+	"06052b81040023":       elliptic.P521(),
+}
+
+// PKCS11Key a crypto.Signer with the RSA or ECDSA private key in a PKCS#11
+// token, the private key never leaves the token
+type PKCS11Key struct {
+	sync.Mutex
+	ctx        *pkcs11.Ctx
+	session    pkcs11.SessionHandle
+	privateKey pkcs11.ObjectHandle
+	publicKey  crypto.PublicKey
+}
+
+// NewPKCS11Signer create a Signer with the key pair labelled keyLabel in the
+// PKCS#11 token labelled tokenLabel. The module is the PKCS#11 library, for
+// example /usr/lib/softhsm/libsofthsm2.so
+func NewPKCS11Signer(alg jwa.SignatureAlgorithm, module string, tokenLabel string, pin string, keyLabel string) (Signer, error) {
+	key, err := OpenPKCS11Key(module, tokenLabel, pin, keyLabel)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkSignatureKey(alg, key.Public()); err != nil {
+		return nil, err
+	}
+	return NewCryptoSigner(alg, key), nil
+}
+
+// OpenPKCS11Key login the PKCS#11 token and find the key pair by label
+func OpenPKCS11Key(module string, tokenLabel string, pin string, keyLabel string) (*PKCS11Key, error) {
+	ctx := pkcs11.New(module)
+	if ctx == nil {
+		return nil, fmt.Errorf("Fail to load PKCS#11 module %s", module)
+	}
+	if err := ctx.Initialize(); err != nil && err != pkcs11.Error(pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED) {
+		return nil, err
+	}
+	slot, err := findPKCS11Slot(ctx, tokenLabel)
+	if err != nil {
+		return nil, err
+	}
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return nil, err
+	}
+	if err = ctx.Login(session, pkcs11.CKU_USER, pin); err != nil && err != pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+		return nil, err
+	}
+	key := &PKCS11Key{ctx: ctx, session: session}
+	key.privateKey, err = key.findObject(pkcs11.CKO_PRIVATE_KEY, keyLabel)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := key.findObject(pkcs11.CKO_PUBLIC_KEY, keyLabel)
+	if err != nil {
+		return nil, err
+	}
+	key.publicKey, err = key.getPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func findPKCS11Slot(ctx *pkcs11.Ctx, tokenLabel string) (uint, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, err
+	}
+	for _, slot := range slots {
+		info, err := ctx.GetTokenInfo(slot)
+		if err == nil && info.Label == tokenLabel {
+			return slot, nil
+		}
+	}
+	return 0, fmt.Errorf("No PKCS#11 token with label %s", tokenLabel)
+}
+
+func (k *PKCS11Key) findObject(class uint, label string) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label)}
+	if err := k.ctx.FindObjectsInit(k.session, template); err != nil {
+		return 0, err
+	}
+	defer k.ctx.FindObjectsFinal(k.session)
+	objects, _, err := k.ctx.FindObjects(k.session, 1)
+	if err != nil {
+		return 0, err
+	}
+	if len(objects) <= 0 {
+		return 0, fmt.Errorf("No key with label %s in PKCS#11 token", label)
+	}
+	return objects[0], nil
+}
+
+// getPublicKey get the RSA public key from CKA_MODULUS and CKA_PUBLIC_EXPONENT
+// or the EC public key from CKA_EC_PARAMS and CKA_EC_POINT
+func (k *PKCS11Key) getPublicKey(object pkcs11.ObjectHandle) (crypto.PublicKey, error) {
+	attrs, err := k.ctx.GetAttributeValue(k.session, object, []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil)})
+	if err == nil {
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(attrs[0].Value),
+			E: int(new(big.Int).SetBytes(attrs[1].Value).Int64())}, nil
+	}
+	attrs, err = k.ctx.GetAttributeValue(k.session, object, []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil)})
+	if err != nil {
+		return nil, fmt.Errorf("Only RSA and EC keys in PKCS#11 token are supported")
+	}
+	curve, ok := ecCurves[fmt.Sprintf("%x", attrs[0].Value)]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported EC curve in PKCS#11 token")
+	}
+	var point []byte
+	if _, err = asn1.Unmarshal(attrs[1].Value, &point); err != nil {
+		return nil, err
+	}
+	x, y := elliptic.Unmarshal(curve, point)
+	if x == nil {
+		return nil, fmt.Errorf("Invalid EC point in PKCS#11 token")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// Public get the public key
+func (k *PKCS11Key) Public() crypto.PublicKey {
+	return k.publicKey
+}
+
+// Sign sign the digest in the PKCS#11 token. The RSA signature is in PKCS#1
+// v1.5 or PSS if the opts is *rsa.PSSOptions, and the ECDSA signature is in
+// ASN.1 DER format as required by crypto.Signer
+func (k *PKCS11Key) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	k.Lock()
+	defer k.Unlock()
+
+	hash := opts.HashFunc()
+	switch k.publicKey.(type) {
+	case *rsa.PublicKey:
+		if pssOpts, ok := opts.(*rsa.PSSOptions); ok {
+			mechs, ok := pssMechanisms[hash]
+			if !ok {
+				return nil, fmt.Errorf("Unsupported hash function %v", hash)
+			}
+			params := pkcs11.NewPSSParams(mechs[0], mechs[1], uint(hash.Size()))
+			if pssOpts.SaltLength > 0 {
+				params = pkcs11.NewPSSParams(mechs[0], mechs[1], uint(pssOpts.SaltLength))
+			}
+			return k.sign(pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS_PSS, params), digest)
+		}
+		prefix, ok := pkcs1DigestInfoPrefix[hash]
+		if !ok {
+			return nil, fmt.Errorf("Unsupported hash function %v", hash)
+		}
+		return k.sign(pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil), append(append([]byte{}, prefix...), digest...))
+	case *ecdsa.PublicKey:
+		sig, err := k.sign(pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil), digest)
+		if err != nil {
+			return nil, err
+		}
+		return asn1.Marshal(struct {
+			R, S *big.Int
+		}{new(big.Int).SetBytes(sig[:len(sig)/2]), new(big.Int).SetBytes(sig[len(sig)/2:])})
+	}
+	return nil, fmt.Errorf("Unsupported key %T", k.publicKey)
+}
+
+func (k *PKCS11Key) sign(mech *pkcs11.Mechanism, data []byte) ([]byte, error) {
+	if err := k.ctx.SignInit(k.session, []*pkcs11.Mechanism{mech}, k.privateKey); err != nil {
+		return nil, err
+	}
+	return k.ctx.Sign(k.session, data)
+}
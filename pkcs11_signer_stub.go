@@ -0,0 +1,14 @@
+//go:build !pkcs11
+// +build !pkcs11
+
+package main
+
+import (
+	"fmt"
+	"github.com/lestrrat-go/jwx/jwa"
+)
+
+// NewPKCS11Signer is not supported unless built with "-tags pkcs11"
+func NewPKCS11Signer(alg jwa.SignatureAlgorithm, module string, tokenLabel string, pin string, keyLabel string) (Signer, error) {
+	return nil, fmt.Errorf("PKCS#11 is not supported, please build with \"-tags pkcs11\"")
+}
@@ -0,0 +1,76 @@
+//go:build pkcs11
+// +build pkcs11
+
+package main
+
+import (
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/miekg/pkcs11"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestPKCS11Signer runs against SoftHSM, for example:
+//
+//	softhsm2-util --init-token --free --label oauth5g --pin 1234 --so-pin 1234
+//	PKCS11_MODULE=/usr/lib/softhsm/libsofthsm2.so PKCS11_TOKEN=oauth5g PKCS11_PIN=1234 go test -tags pkcs11 -run PKCS11
+func TestPKCS11Signer(t *testing.T) {
+	module := os.Getenv("PKCS11_MODULE")
+	if len(module) <= 0 {
+		t.Skip("PKCS11_MODULE is not set")
+	}
+	tokenLabel := os.Getenv("PKCS11_TOKEN")
+	pin := os.Getenv("PKCS11_PIN")
+	keyLabel := "oauth5g-test-key"
+
+	ctx := pkcs11.New(module)
+	if err := ctx.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	slot, err := findPKCS11Slot(ctx, tokenLabel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ctx.Login(session, pkcs11.CKU_USER, pin); err != nil {
+		t.Fatal(err)
+	}
+	// the DER encoded OID of P-256
+	p256 := []byte{0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07}
+	publicKey, privateKey, err := ctx.GenerateKeyPair(session,
+		[]*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_EC_KEY_PAIR_GEN, nil)},
+		[]*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+			pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, p256),
+			pkcs11.NewAttribute(pkcs11.CKA_LABEL, keyLabel)},
+		[]*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+			pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+			pkcs11.NewAttribute(pkcs11.CKA_LABEL, keyLabel)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.DestroyObject(session, publicKey)
+	defer ctx.DestroyObject(session, privateKey)
+
+	signer, err := NewPKCS11Signer(jwa.ES256, module, tokenLabel, pin, keyLabel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.ES256, nil)
+	if err = server.SetSigner(signer); err != nil {
+		t.Fatal(err)
+	}
+	token, err := createTokenWithServer(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = NewAccessTokenVerifier(jwa.ES256, signer.Public()).VerifyToken([]byte(token)); err != nil {
+		t.Error(err)
+	}
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/lestrrat-go/jwx/jwa"
@@ -9,6 +11,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 )
 
 // Proxy oauth2 proxy
@@ -19,6 +22,14 @@ type Proxy struct {
 	client     *OAuthClient
 	verifier   *AccessTokenVerifier
 	tokenCache *TokenCache
+	// create the client credentials assertion on behalf of the local NF
+	clientAssertionSigner *ClientAssertionSigner
+	// the nfInstanceId of the local NF, the assertion is created only for it
+	localNfInstanceID string
+	// the header contains the client certificate forwarded by the TLS terminator
+	clientCertHeader *ClientCertHeader
+	// the revoked tokens pulled from or pushed by the authorization server
+	revocationList *RevocationList
 }
 
 // NewProxy create a new Proxy object
@@ -28,17 +39,108 @@ func NewProxy(tokenReqPath string,
 	authServerTLSConfig *tls.Config,
 	http2OAuthServer bool,
 	tokenVerifyAlgorithm jwa.SignatureAlgorithm,
-	key interface{}) *Proxy {
+	keySource VerificationKeySource) *Proxy {
 	router := gin.New()
 	proxy := &Proxy{router: router,
-		client:     NewOAuthClient(oauthServerURL, http2OAuthServer, authServerTLSConfig),
-		verifier:   NewAccessTokenVerifier(tokenVerifyAlgorithm, key),
-		tokenCache: NewTokenCache(5 * 60)}
+		client:         NewOAuthClient(oauthServerURL, http2OAuthServer, authServerTLSConfig),
+		verifier:       NewAccessTokenVerifierWithKeySource(tokenVerifyAlgorithm, keySource),
+		tokenCache:     NewTokenCache(5 * 60),
+		revocationList: NewRevocationList(24 * time.Hour)}
+	proxy.verifier.SetRevocationList(proxy.revocationList)
 	router.POST(tokenReqPath, proxy.HandleTokenRequest)
 	router.POST(tokenVerifyPath, proxy.HandleTokenVerify)
 	return proxy
 }
 
+// SetClientAssertionSigner set the signer to create the client credentials
+// assertion for the token request of the local NF with nfInstanceID without
+// client_assertion. The token request of other NF instances is rejected
+func (p *Proxy) SetClientAssertionSigner(nfInstanceID string, signer *ClientAssertionSigner) {
+	p.localNfInstanceID = nfInstanceID
+	p.clientAssertionSigner = signer
+}
+
+// SetClientCertHeader set the header which contains the client certificate
+// forwarded by the trusted TLS terminator of the producer. The certificate is
+// used to verify the certificate bound token
+func (p *Proxy) SetClientCertHeader(header *ClientCertHeader) {
+	p.clientCertHeader = header
+}
+
+// SetVerificationOptions set the expected claims of the verified token, for
+// example the aud, the issuers and the PLMN of the producer
+func (p *Proxy) SetVerificationOptions(options *VerificationOptions) {
+	p.verifier.SetVerificationOptions(options)
+}
+
+// SetClockSkew set the allowed clock difference between the authorization
+// server and the proxy when verifying the token
+func (p *Proxy) SetClockSkew(clockSkew time.Duration) {
+	p.verifier.SetClockSkew(clockSkew)
+}
+
+// CreateAuthorizingProxy create a AuthorizingProxy in front of the producer in
+// the upstreamURL. It verifies the token like HandleTokenVerify
+func (p *Proxy) CreateAuthorizingProxy(upstreamURL string, http2Upstream bool, tlsConfig *tls.Config) (*AuthorizingProxy, error) {
+	authorizingProxy, err := NewAuthorizingProxy(upstreamURL, http2Upstream, tlsConfig, p.verifier)
+	if err != nil {
+		return nil, err
+	}
+	authorizingProxy.SetClientCertHeader(p.clientCertHeader)
+	return authorizingProxy, nil
+}
+
+// EnableIntrospection enable the token introspection endpoint defined in RFC 7662
+// in the introspectPath. The token is verified locally like HandleTokenVerify
+// and the caller is authenticated by the authenticator
+func (p *Proxy) EnableIntrospection(introspectPath string, authenticator *EndpointAuthenticator) {
+	p.router.POST(introspectPath, func(c *gin.Context) {
+		handleIntrospection(c, p.verifier, authenticator)
+	})
+}
+
+// EnableRevocationPush accept the revocation list pushed by the authorization
+// server in the pushPath. The caller is authenticated by the authenticator
+func (p *Proxy) EnableRevocationPush(pushPath string, authenticator *EndpointAuthenticator) {
+	p.router.POST(pushPath, func(c *gin.Context) {
+		if !authenticateEndpoint(c, authenticator, "revocation") {
+			return
+		}
+		data := &RevocationListData{}
+		if err := c.BindJSON(data); err != nil {
+			return
+		}
+		p.revocationList.Merge(data)
+		c.Status(http.StatusOK)
+	})
+}
+
+// StartRevocationPull pull the revocation list from the listURL of the
+// authorization server with the client every interval in background
+func (p *Proxy) StartRevocationPull(client *OAuthClient, listURL string, interval time.Duration) {
+	go func() {
+		for {
+			if err := p.pullRevocationList(client, listURL); err != nil {
+				log.Error("Fail to pull the revocation list from ", listURL, " with error:", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+func (p *Proxy) pullRevocationList(client *OAuthClient, listURL string) error {
+	b, err := client.Get(listURL)
+	if err != nil {
+		return err
+	}
+	data := &RevocationListData{}
+	if err = json.Unmarshal(b, data); err != nil {
+		return err
+	}
+	p.revocationList.Merge(data)
+	return nil
+}
+
 // Start start proxy, listen on the specified address and accept the token
 // access request, the request will be forwarded to the real authorization
 // server
@@ -58,57 +160,109 @@ func (p *Proxy) HandleTokenRequest(c *gin.Context) {
 		err = atr.FromX3WFormEncoding(c.Request.Body)
 	}
 	if err != nil {
-		c.Status(http.StatusBadRequest)
+		log.Error("Fail to decode request with error:", err)
+		c.JSON(http.StatusBadRequest, NewInvalidRequestError("malformed request: %v", err))
 		return
 	}
-	t, err := p.getTokenFromCache(atr)
-	if err == nil {
-		log.Info("Succeed to get the token:", t, " from local cache")
-		c.Status(http.StatusOK)
-		c.Writer.Write([]byte(t))
+	if accessTokenErr := atr.Validate(); accessTokenErr != nil {
+		log.Error("Invalid request: ", accessTokenErr.ErrorDescription)
+		c.JSON(http.StatusBadRequest, accessTokenErr)
 		return
 	}
-	b, err := atr.ToX3WFormEncoding()
-
+	resp, err := p.RequestToken(atr)
 	if err != nil {
+		log.Error("Fail to get the token with error:", err)
 		c.Status(http.StatusBadRequest)
 		return
 	}
+	c.JSON(http.StatusOK, resp)
+}
 
-	if r, err := p.client.RequestToken(b); err == nil {
-		log.Info("Succeed to get the token:", string(r), " from remote server")
-		resp := NewAccessTokenResponse()
-		if resp.FromJSON(r) != nil {
-			c.Status(http.StatusBadRequest)
-			return
+// RequestToken get the token from the local cache, or request it from the
+// authorization server with the client credentials assertion if the signer is set
+func (p *Proxy) RequestToken(atr *AccessTokenRequest) (*AccessTokenResponse, error) {
+	t, expireTime, scope, err := p.getTokenFromCache(atr)
+	if err == nil {
+		log.Info("Succeed to get the token:", t, " from local cache")
+		return &AccessTokenResponse{AccessToken: t,
+			TokenType: "Bearer",
+			ExpiresIn: getExpiresIn(expireTime),
+			Scope:     scope}, nil
+	}
+	return p.requestToken(atr, false)
+}
+
+// RequestNewToken request a new token from the authorization server without
+// the token cached by the proxy or the server, for example the cached token
+// is rejected by the producer
+func (p *Proxy) RequestNewToken(atr *AccessTokenRequest) (*AccessTokenResponse, error) {
+	return p.requestToken(atr, true)
+}
+
+func (p *Proxy) requestToken(atr *AccessTokenRequest, noCache bool) (*AccessTokenResponse, error) {
+	var err error
+	if p.clientAssertionSigner != nil && len(atr.ClientAssertion) <= 0 {
+		if atr.NfInstanceID != p.localNfInstanceID {
+			return nil, fmt.Errorf("The client assertion can't be created for %s other than the local NF %s", atr.NfInstanceID, p.localNfInstanceID)
 		}
-		p.cacheTokenFor(atr, resp.ExpiresIn, resp.AccessToken)
-		c.Status(http.StatusOK)
-		c.Writer.Write(r)
-		return
+		// sign a copy of the request, the assertion with its jti can be used
+		// only once and must not be reused by the caller, e.g. when retrying
+		signed := *atr
+		signed.ClientAssertion, err = p.clientAssertionSigner.Sign(atr.NfInstanceID)
+		if err != nil {
+			return nil, fmt.Errorf("Fail to create client assertion with error:%v", err)
+		}
+		signed.ClientAssertionType = ClientAssertionTypeJWTBearer
+		atr = &signed
 	}
-	log.Error("Fail to get the token with error:", err)
-	c.Status(http.StatusBadRequest)
+	b, err := atr.ToX3WFormEncoding()
+	if err != nil {
+		return nil, err
+	}
+	var r []byte
+	if noCache {
+		r, err = p.client.RequestNewToken(b)
+	} else {
+		r, err = p.client.RequestToken(b)
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Info("Succeed to get the token:", string(r), " from remote server")
+	resp := NewAccessTokenResponse()
+	if err = resp.FromJSON(r); err != nil {
+		return nil, err
+	}
+	p.cacheTokenFor(atr, time.Now().Unix()+resp.ExpiresIn, resp.AccessToken, getGrantedScope(resp, atr))
+	return resp, nil
 }
 
-func (p *Proxy) getTokenFromCache(atr *AccessTokenRequest) (string, error) {
-	if atr.IsRequestByType() {
-		key := fmt.Sprintf("%s@%s-%s", atr.NfInstanceID, atr.NfType, atr.TargetNfType)
+// RemoveToken remove the token of the request from the local cache, for
+// example the token is rejected by the producer
+func (p *Proxy) RemoveToken(atr *AccessTokenRequest) {
+	if key, ok := atr.GetTokenCacheKey(); ok {
+		p.tokenCache.RemoveToken(key)
+	}
+}
+
+func (p *Proxy) getTokenFromCache(atr *AccessTokenRequest) (string, int64, string, error) {
+	if key, ok := atr.GetTokenCacheKey(); ok {
 		log.Info("try to get token  by ", key)
-		return p.tokenCache.GetToken(key)
+		return p.tokenCache.GetGrantedToken(key)
 	}
-	return "", fmt.Errorf("Fail to get token")
+	return "", 0, "", fmt.Errorf("Fail to get token")
 }
 
-func (p *Proxy) cacheTokenFor(atr *AccessTokenRequest, expireTime int64, token string) {
-	if atr.IsRequestByType() {
-		key := fmt.Sprintf("%s@%s-%s", atr.NfInstanceID, atr.NfType, atr.TargetNfType)
+func (p *Proxy) cacheTokenFor(atr *AccessTokenRequest, expireTime int64, token string, scope string) {
+	if key, ok := atr.GetTokenCacheKey(); ok {
 		log.Info("Cache the token ", token, " for ", key, " in expire ", expireTime)
-		p.tokenCache.CacheToken(key, expireTime, token)
+		p.tokenCache.CacheGrantedToken(key, expireTime, token, scope)
 	}
 }
 
-// HandleTokenVerify verify the token got from authorization server with the algoritm and the key
+// HandleTokenVerify verify the token got from authorization server with the algoritm and the key.
+// The certificate bound token is verified with the client certificate in the header configured
+// by SetClientCertHeader. The scope required by the operation can be set in the scope query parameter
 func (p *Proxy) HandleTokenVerify(c *gin.Context) {
 	b, err := c.GetRawData()
 	if err != nil {
@@ -116,7 +270,19 @@ func (p *Proxy) HandleTokenVerify(c *gin.Context) {
 		c.Status(http.StatusBadRequest)
 		return
 	}
-	err = p.verifier.VerifyToken(b)
+	var cert *x509.Certificate
+	if p.clientCertHeader != nil {
+		cert, err = p.clientCertHeader.GetCertificate(c.Request)
+		if err != nil {
+			log.Error("Fail to parse the client certificate in header ", p.clientCertHeader.name, " with error:", err)
+			c.Status(http.StatusBadRequest)
+			return
+		}
+	}
+	claims, err := p.verifier.VerifyTokenWithCertificate(b, cert)
+	if scope := c.Query("scope"); err == nil && len(scope) > 0 {
+		err = (&VerificationOptions{Scope: scope}).Validate(claims)
+	}
 	if err == nil {
 		c.Status(http.StatusOK)
 	} else {
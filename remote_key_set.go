@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// RemoteKeySet a VerificationKeySource fetches the JWK set from the JWKS URL
+// of the authorization server. The JWK set is refreshed periodically and on
+// unknown kid. The last good JWK set is kept if the authorization server is
+// unreachable
+type RemoteKeySet struct {
+	sync.Mutex
+	client  *OAuthClient
+	jwksURL string
+	// the interval to refresh the JWK set periodically
+	refreshInterval time.Duration
+	// the minimal interval between two refreshes triggered by unknown kid
+	minRefreshInterval time.Duration
+	keySet             *jwk.Set
+	lastRefresh        time.Time
+}
+
+// NewRemoteKeySet create a RemoteKeySet object fetches the JWK set from the jwksURL
+// with the client
+func NewRemoteKeySet(client *OAuthClient, jwksURL string, refreshInterval time.Duration) *RemoteKeySet {
+	return &RemoteKeySet{client: client,
+		jwksURL:            jwksURL,
+		refreshInterval:    refreshInterval,
+		minRefreshInterval: 10 * time.Second}
+}
+
+// Start fetch the JWK set and refresh it periodically in background
+func (rks *RemoteKeySet) Start() {
+	if err := rks.Refresh(); err != nil {
+		log.Error("Fail to fetch JWK set from ", rks.jwksURL, " with error:", err)
+	}
+	go func() {
+		for {
+			time.Sleep(rks.refreshInterval)
+			if err := rks.Refresh(); err != nil {
+				log.Error("Fail to refresh JWK set from ", rks.jwksURL, " with error:", err)
+			}
+		}
+	}()
+}
+
+// Refresh fetch the JWK set from the authorization server. The current JWK
+// set is not changed if fail to fetch the JWK set
+func (rks *RemoteKeySet) Refresh() error {
+	rks.Lock()
+	rks.lastRefresh = time.Now()
+	rks.Unlock()
+
+	b, err := rks.client.Get(rks.jwksURL)
+	if err != nil {
+		return err
+	}
+	keySet, err := jwk.ParseBytes(b)
+	if err != nil {
+		return err
+	}
+	if len(keySet.Keys) <= 0 {
+		return fmt.Errorf("No key in the JWK set from %s", rks.jwksURL)
+	}
+
+	rks.Lock()
+	defer rks.Unlock()
+	rks.keySet = keySet
+	log.Info("Succeed to fetch ", len(keySet.Keys), " keys from ", rks.jwksURL)
+	return nil
+}
+
+// GetKey get the key by kid from the JWK set. The JWK set is refreshed if no
+// key with the kid, but not more frequently than the minimal refresh interval
+func (rks *RemoteKeySet) GetKey(kid string) (jwa.SignatureAlgorithm, interface{}, error) {
+	keySet, lastRefresh := rks.getKeySet()
+	if keySet != nil {
+		alg, key, err := getKeyFromSet(keySet, kid)
+		if err == nil || time.Since(lastRefresh) < rks.minRefreshInterval {
+			return alg, key, err
+		}
+	} else if time.Since(lastRefresh) < rks.minRefreshInterval {
+		return "", nil, fmt.Errorf("No JWK set from %s", rks.jwksURL)
+	}
+	log.Info("Refresh JWK set for kid ", kid)
+	if err := rks.Refresh(); err != nil {
+		log.Error("Fail to refresh JWK set from ", rks.jwksURL, " with error:", err)
+	}
+	keySet, _ = rks.getKeySet()
+	if keySet == nil {
+		return "", nil, fmt.Errorf("No JWK set from %s", rks.jwksURL)
+	}
+	return getKeyFromSet(keySet, kid)
+}
+
+func (rks *RemoteKeySet) getKeySet() (*jwk.Set, time.Time) {
+	rks.Lock()
+	defer rks.Unlock()
+	return rks.keySet, rks.lastRefresh
+}
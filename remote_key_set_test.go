@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/lestrrat-go/jwx/jwa"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRemoteKeySet(t *testing.T) {
+	key, err := loadSignatureKey([]byte(privateKey))
+	if err != nil {
+		t.Fail()
+	}
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	server.SetKeyID("key-1")
+	server.EnableJWKS("/oauth2/jwks")
+	httpServer := httptest.NewServer(server.router)
+
+	jwksURL := httpServer.URL + "/oauth2/jwks"
+	remoteKeySet := NewRemoteKeySet(NewOAuthClient(jwksURL, false, nil), jwksURL, time.Hour)
+	remoteKeySet.minRefreshInterval = 0
+	if err = remoteKeySet.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	verifier := NewAccessTokenVerifierWithKeySource(jwa.RS256, remoteKeySet)
+	token, _ := createTokenWithServer(server)
+	if err = verifier.VerifyToken([]byte(token)); err != nil {
+		t.Error(err)
+	}
+
+	// refresh on unknown kid
+	server.SetKeyID("key-2")
+	server.tokenCache = NewTokenCache(0)
+	token, _ = createTokenWithServer(server)
+	if err = verifier.VerifyToken([]byte(token)); err != nil {
+		t.Error(err)
+	}
+
+	// keep the last good key set
+	httpServer.Close()
+	if remoteKeySet.Refresh() == nil {
+		t.Fail()
+	}
+	if _, _, err = remoteKeySet.GetKey("key-2"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/lestrrat-go/jwx/jwa"
+)
+
+// RemoteSignRequest the request sent to the remote signing service
+type RemoteSignRequest struct {
+	Algorithm string `json:"alg"`
+	// the base64url-encoded JWS signing input
+	Data string `json:"data"`
+}
+
+// RemoteSignResponse the response of the remote signing service
+type RemoteSignResponse struct {
+	// the base64url-encoded JWS signature
+	Signature string `json:"signature"`
+}
+
+// RemoteSigner a Signer delegates the signing to a remote signing service,
+// the private key is kept by the signing service. The signing input is posted
+// to the signing service in RemoteSignRequest and the signature is replied
+// in RemoteSignResponse
+type RemoteSigner struct {
+	alg       jwa.SignatureAlgorithm
+	signURL   string
+	client    *OAuthClient
+	publicKey crypto.PublicKey
+}
+
+// NewRemoteSigner create a RemoteSigner with the signing service url and
+// the public key of the key kept by the signing service
+func NewRemoteSigner(alg jwa.SignatureAlgorithm, signURL string, client *OAuthClient, publicKey crypto.PublicKey) *RemoteSigner {
+	return &RemoteSigner{alg: alg,
+		signURL:   signURL,
+		client:    client,
+		publicKey: publicKey}
+}
+
+// Algorithm get the signature algorithm
+func (rs *RemoteSigner) Algorithm() jwa.SignatureAlgorithm {
+	return rs.alg
+}
+
+// Public get the public key of the remote key
+func (rs *RemoteSigner) Public() crypto.PublicKey {
+	return rs.publicKey
+}
+
+// Sign sign the JWS signing input by the remote signing service
+func (rs *RemoteSigner) Sign(signingInput []byte) ([]byte, error) {
+	b, err := json.Marshal(&RemoteSignRequest{Algorithm: rs.alg.String(),
+		Data: base64.RawURLEncoding.EncodeToString(signingInput)})
+	if err != nil {
+		return nil, err
+	}
+	b, err = rs.client.Post(rs.signURL, "application/json", b)
+	if err != nil {
+		return nil, err
+	}
+	resp := &RemoteSignResponse{}
+	if err = json.Unmarshal(b, resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Signature) <= 0 {
+		return nil, fmt.Errorf("No signature from remote signing service %s", rs.signURL)
+	}
+	return base64.RawURLEncoding.DecodeString(resp.Signature)
+}
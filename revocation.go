@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// RevocationListData the revocation list exchanged between the authorization
+// server and the proxies
+type RevocationListData struct {
+	// the revoked jti and the expiration time of the token
+	Jtis map[string]int64 `json:"jtis"`
+	// the NF instance id of the NF service consumer and the time, all
+	// the tokens issued to the NF instance before or at the time are revoked
+	Subjects map[string]int64 `json:"subjects"`
+	// all the tokens issued before or at the time are revoked
+	RevokedBefore int64 `json:"revokedBefore,omitempty"`
+}
+
+// RevocationList the revoked tokens. A token is revoked if:
+// - its jti is revoked, or
+// - it is issued to a revoked subject before the subject is revoked, or
+// - it is issued before the revokedBefore time
+type RevocationList struct {
+	sync.Mutex
+	data RevocationListData
+	// the revoked subject is removed after the retention because all
+	// the tokens issued before are expired
+	retention time.Duration
+	// called after the revocation list is changed
+	listeners []func(*RevocationListData)
+}
+
+// NewRevocationList create a RevocationList. The retention should be not less
+// than the token expire duration
+func NewRevocationList(retention time.Duration) *RevocationList {
+	return &RevocationList{data: RevocationListData{Jtis: make(map[string]int64), Subjects: make(map[string]int64)},
+		retention: retention,
+		listeners: make([]func(*RevocationListData), 0)}
+}
+
+// AddListener add a listener called with the revocation list after it is changed
+func (rl *RevocationList) AddListener(listener func(*RevocationListData)) {
+	rl.Lock()
+	defer rl.Unlock()
+	rl.listeners = append(rl.listeners, listener)
+}
+
+// RevokeToken revoke the token with the jti and expiration time
+func (rl *RevocationList) RevokeToken(jti string, exp int64) {
+	rl.update(func(data *RevocationListData) {
+		data.Jtis[jti] = exp
+	})
+}
+
+// RevokeSubject revoke all the tokens issued to the NF instance before or at
+// the time
+func (rl *RevocationList) RevokeSubject(nfInstanceID string, before int64) {
+	rl.update(func(data *RevocationListData) {
+		if data.Subjects[nfInstanceID] < before {
+			data.Subjects[nfInstanceID] = before
+		}
+	})
+}
+
+// RevokeBefore revoke all the tokens issued before or at the time
+func (rl *RevocationList) RevokeBefore(before int64) {
+	rl.update(func(data *RevocationListData) {
+		if data.RevokedBefore < before {
+			data.RevokedBefore = before
+		}
+	})
+}
+
+// Merge merge the revocation list pulled from or pushed by the authorization server
+func (rl *RevocationList) Merge(other *RevocationListData) {
+	rl.update(func(data *RevocationListData) {
+		for jti, exp := range other.Jtis {
+			data.Jtis[jti] = exp
+		}
+		for sub, before := range other.Subjects {
+			if data.Subjects[sub] < before {
+				data.Subjects[sub] = before
+			}
+		}
+		if data.RevokedBefore < other.RevokedBefore {
+			data.RevokedBefore = other.RevokedBefore
+		}
+	})
+}
+
+// IsRevoked return true if the token with the claims is revoked
+func (rl *RevocationList) IsRevoked(claims *AccessTokenClaims) bool {
+	rl.Lock()
+	defer rl.Unlock()
+
+	if rl.data.RevokedBefore > 0 && claims.Iat <= rl.data.RevokedBefore {
+		return true
+	}
+	if before, ok := rl.data.Subjects[claims.Sub]; ok && claims.Iat <= before {
+		return true
+	}
+	_, ok := rl.data.Jtis[claims.Jti]
+	return ok && len(claims.Jti) > 0
+}
+
+// GetData get a copy of the revocation list
+func (rl *RevocationList) GetData() *RevocationListData {
+	rl.Lock()
+	defer rl.Unlock()
+	return rl.copyData()
+}
+
+// ToJSON convert the revocation list to json
+func (rl *RevocationList) ToJSON() ([]byte, error) {
+	return json.Marshal(rl.GetData())
+}
+
+func (rl *RevocationList) update(change func(*RevocationListData)) {
+	rl.Lock()
+	change(&rl.data)
+	rl.removeExpired()
+	data := rl.copyData()
+	listeners := rl.listeners
+	rl.Unlock()
+
+	for _, listener := range listeners {
+		listener(data)
+	}
+}
+
+func (rl *RevocationList) removeExpired() {
+	now := time.Now().Unix()
+	for jti, exp := range rl.data.Jtis {
+		if exp < now {
+			delete(rl.data.Jtis, jti)
+		}
+	}
+	for sub, before := range rl.data.Subjects {
+		if before < now-int64(rl.retention.Seconds()) {
+			delete(rl.data.Subjects, sub)
+		}
+	}
+}
+
+func (rl *RevocationList) copyData() *RevocationListData {
+	data := &RevocationListData{Jtis: make(map[string]int64),
+		Subjects:      make(map[string]int64),
+		RevokedBefore: rl.data.RevokedBefore}
+	for k, v := range rl.data.Jtis {
+		data.Jtis[k] = v
+	}
+	for k, v := range rl.data.Subjects {
+		data.Subjects[k] = v
+	}
+	return data
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/lestrrat-go/jwx/jwa"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func revoke(handler http.Handler, path string, token string, clientID string, secret string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(url.Values{"token": {token}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if len(clientID) > 0 {
+		req.SetBasicAuth(clientID, secret)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestRevokeToken(t *testing.T) {
+	key, _ := loadSignatureKey([]byte(privateKey))
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	server.EnableRevocation("/oauth2/revoke", NewEndpointAuthenticator(map[string]string{"amf": "amf-secret",
+		"5a7bd676-ceeb-44bb-95e0-f6a55a312345": "lmf-secret"}, false))
+	token, err := createTokenWithServer(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := server.createVerifier()
+	if _, err = verifier.VerifyTokenClaims([]byte(token)); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := revoke(server.router, "/oauth2/revoke", token, "amf", "wrong-secret"); w.Code != http.StatusUnauthorized {
+		t.Error("The caller with wrong secret should be rejected")
+	}
+	if w := revoke(server.router, "/oauth2/revoke", "invalid-token", "amf", "amf-secret"); w.Code != http.StatusOK {
+		t.Error("The invalid token should be ignored")
+	}
+	if w := revoke(server.router, "/oauth2/revoke", token, "amf", "amf-secret"); w.Code != http.StatusBadRequest {
+		t.Error("The token issued to other client should not be revoked ", w.Code)
+	}
+	if _, err = verifier.VerifyTokenClaims([]byte(token)); err != nil {
+		t.Fatal("The token should not be revoked by other client ", err)
+	}
+	if w := revoke(server.router, "/oauth2/revoke", token, "5a7bd676-ceeb-44bb-95e0-f6a55a312345", "lmf-secret"); w.Code != http.StatusOK {
+		t.Fatal("Fail to revoke token ", w.Body.String())
+	}
+	if _, err = verifier.VerifyTokenClaims([]byte(token)); err == nil {
+		t.Error("The revoked token in the verified cache should be rejected")
+	}
+	newToken, err := createTokenWithServer(server)
+	if err != nil || newToken == token {
+		t.Error("The revoked token should not be returned from the token cache")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/oauth2/revoke", nil)
+	req.SetBasicAuth("amf", "amf-secret")
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	data := &RevocationListData{}
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), data) != nil || len(data.Jtis) != 1 {
+		t.Error("Fail to get the revocation list ", w.Body.String())
+	}
+}
+
+func TestRevokedTokenNotServedFromCache(t *testing.T) {
+	key, _ := loadSignatureKey([]byte(privateKey))
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	// the tokens issued after the cache is cleared are revoked too
+	server.GetRevocationList().RevokeBefore(time.Now().Unix() + 60)
+	token, err := createTokenWithServer(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = server.createVerifier().VerifyTokenClaims([]byte(token)); err == nil {
+		t.Fatal("The token issued before the revokedBefore should be revoked")
+	}
+	if newToken, err := createTokenWithServer(server); err != nil || newToken == token {
+		t.Error("The revoked token should not be returned from the token cache")
+	}
+}
+
+func TestRevokeBySubject(t *testing.T) {
+	key, _ := loadSignatureKey([]byte(privateKey))
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	server.EnableAdminAPI("/admin", NewEndpointAuthenticator(map[string]string{"admin": "admin-secret"}, false))
+	token, _ := createTokenWithServer(server)
+	verifier := server.createVerifier()
+
+	b, _ := json.Marshal(&RevocationRequest{Sub: "5a7bd676-ceeb-44bb-95e0-f6a55a312345"})
+	req := httptest.NewRequest(http.MethodPost, "/admin/revocations", bytes.NewReader(b))
+	req.SetBasicAuth("admin", "admin-secret")
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatal("Fail to revoke the subject ", w.Body.String())
+	}
+	if _, err := verifier.VerifyTokenClaims([]byte(token)); err == nil {
+		t.Error("The token issued to the revoked subject should be rejected")
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/admin/revocations", strings.NewReader("{}"))
+	req.SetBasicAuth("admin", "admin-secret")
+	w = httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Error("The empty revocation request should be rejected")
+	}
+}
+
+func TestAdminRevocationAuthentication(t *testing.T) {
+	key, _ := loadSignatureKey([]byte(privateKey))
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	server.EnableRevocation("/oauth2/revoke", NewEndpointAuthenticator(map[string]string{"oam": "oam-secret",
+		"5a7bd676-ceeb-44bb-95e0-f6a55a312345": "lmf-secret"}, false))
+	token, _ := createTokenWithServer(server)
+	server.EnableAdminAPI("/admin", NewEndpointAuthenticator(map[string]string{"admin": "admin-secret"}, false))
+	verifier := server.createVerifier()
+
+	revokeBefore := func(clientID string, secret string) int {
+		b, _ := json.Marshal(&RevocationRequest{Before: time.Now().Unix() + 60})
+		req := httptest.NewRequest(http.MethodPost, "/admin/revocations", bytes.NewReader(b))
+		if len(clientID) > 0 {
+			req.SetBasicAuth(clientID, secret)
+		}
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w.Code
+	}
+	for _, credentials := range [][]string{{"", ""}, {"oam", "wrong-secret"}, {"admin", "wrong-secret"}} {
+		if code := revokeBefore(credentials[0], credentials[1]); code != http.StatusUnauthorized {
+			t.Error("The unauthenticated caller should be rejected ", credentials[0], code)
+		}
+	}
+	if code := revokeBefore("oam", "oam-secret"); code != http.StatusForbidden {
+		t.Error("The client of the revocation endpoint should not revoke the tokens of others ", code)
+	}
+	if _, err := verifier.VerifyTokenClaims([]byte(token)); err != nil {
+		t.Fatal("The token should not be revoked by the caller other than the administrator ", err)
+	}
+	if code := revokeBefore("admin", "admin-secret"); code != http.StatusOK {
+		t.Fatal("Fail to revoke the tokens ", code)
+	}
+	if _, err := verifier.VerifyTokenClaims([]byte(token)); err == nil {
+		t.Error("The token issued before the time should be revoked")
+	}
+
+	revokeSubject := func(clientID string, secret string) int {
+		b, _ := json.Marshal(&RevocationRequest{Sub: "5a7bd676-ceeb-44bb-95e0-f6a55a312345"})
+		req := httptest.NewRequest(http.MethodPost, "/admin/revocations", bytes.NewReader(b))
+		req.SetBasicAuth(clientID, secret)
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := revokeSubject("oam", "oam-secret"); code != http.StatusForbidden {
+		t.Error("The client of the revocation endpoint should not revoke other subjects ", code)
+	}
+	if code := revokeSubject("5a7bd676-ceeb-44bb-95e0-f6a55a312345", "lmf-secret"); code != http.StatusOK {
+		t.Error("The client of the revocation endpoint should revoke its own tokens ", code)
+	}
+}
+
+func TestRevocationList(t *testing.T) {
+	now := time.Now().Unix()
+	rl := NewRevocationList(time.Hour)
+	changed := 0
+	rl.AddListener(func(data *RevocationListData) {
+		changed++
+	})
+	rl.RevokeToken("jti-1", now+60)
+	rl.RevokeToken("jti-2", now-60)
+	rl.RevokeBefore(now - 100)
+	if changed != 3 {
+		t.Error("The listener should be called on every change")
+	}
+	if !rl.IsRevoked(&AccessTokenClaims{Jti: "jti-1", Iat: now}) || rl.IsRevoked(&AccessTokenClaims{Jti: "jti-3", Iat: now}) {
+		t.Error("Fail to check the revoked jti")
+	}
+	if !rl.IsRevoked(&AccessTokenClaims{Jti: "jti-3", Iat: now - 200}) {
+		t.Error("The token issued before the revokedBefore time should be revoked")
+	}
+	if rl.IsRevoked(&AccessTokenClaims{Iat: now}) {
+		t.Error("The token without jti should not be revoked by jti")
+	}
+	if _, ok := rl.GetData().Jtis["jti-2"]; ok {
+		t.Error("The expired jti should be removed")
+	}
+}
+
+func TestProxyRevocationPullAndPush(t *testing.T) {
+	key, _ := loadSignatureKey([]byte(privateKey))
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	server.EnableRevocation("/oauth2/revoke", NewEndpointAuthenticator(map[string]string{"proxy": "proxy-secret"}, false))
+	token1, _ := createTokenWithServer(server)
+	claims1, _ := server.createVerifier().VerifyTokenClaims([]byte(token1))
+	server.GetRevocationList().RevokeToken(claims1.Jti, claims1.Exp)
+	ts := httptest.NewServer(server.router)
+	defer ts.Close()
+
+	pubKey, _ := loadSignatureKey([]byte(publicKey))
+	proxy := NewProxy("/reqtoken", "/verify", ts.URL, nil, false, jwa.RS256, NewStaticKeySource(pubKey))
+	client := NewOAuthClient(ts.URL, false, nil)
+	client.SetBasicAuth("proxy", "proxy-secret")
+	if err := proxy.pullRevocationList(client, ts.URL+"/oauth2/revoke"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := proxy.verifier.VerifyTokenClaims([]byte(token1)); err == nil {
+		t.Error("The token revoked in the pulled list should be rejected")
+	}
+
+	proxy.EnableRevocationPush("/revocations", NewEndpointAuthenticator(map[string]string{"nrf": "nrf-secret"}, false))
+	b, _ := json.Marshal(&RevocationListData{Subjects: map[string]int64{"5a7bd676-ceeb-44bb-95e0-f6a55a312345": time.Now().Unix()}})
+	req := httptest.NewRequest(http.MethodPost, "/revocations", bytes.NewReader(b))
+	req.SetBasicAuth("nrf", "nrf-secret")
+	w := httptest.NewRecorder()
+	proxy.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatal("Fail to push the revocation list ", w.Body.String())
+	}
+	if !proxy.revocationList.IsRevoked(&AccessTokenClaims{Sub: "5a7bd676-ceeb-44bb-95e0-f6a55a312345", Iat: time.Now().Unix() - 10}) {
+		t.Error("The subject in the pushed list should be revoked")
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+// SetPlmnIDs set the PLMNs served by the authorization server. The token
+// request for a targetPlmn not in the list is forwarded to the authorization
+// server of the target PLMN. All the PLMNs are served if it is not set
+func (s *OAuthServer) SetPlmnIDs(plmnIDs []*PlmnID) {
+	s.plmnIDs = plmnIDs
+}
+
+// AddPeerPlmn forward the token requests for the plmnID to the authorization
+// server of the peer PLMN by the client, for example through the SEPP. The
+// requests from the consumers of the peer PLMN are accepted only if they are
+// forwarded by the SEPP or NRF of the peer PLMN authenticated by the
+// authenticator. No request is accepted as from the peer PLMN if the
+// authenticator is nil
+func (s *OAuthServer) AddPeerPlmn(plmnID *PlmnID, client *OAuthClient, authenticator *EndpointAuthenticator) {
+	if s.peerPlmnClients == nil {
+		s.peerPlmnClients = make(map[string]*OAuthClient)
+		s.peerPlmnAuthenticators = make(map[string]*EndpointAuthenticator)
+	}
+	s.peerPlmnClients[plmnID.String()] = client
+	if authenticator != nil {
+		s.peerPlmnAuthenticators[plmnID.String()] = authenticator
+	} else {
+		delete(s.peerPlmnAuthenticators, plmnID.String())
+	}
+}
+
+func (s *OAuthServer) getPeerPlmnClient(plmnID *PlmnID) (*OAuthClient, bool) {
+	client, ok := s.peerPlmnClients[plmnID.String()]
+	return client, ok
+}
+
+// isOwnPlmn return true if the plmnID is served by the authorization server
+func (s *OAuthServer) isOwnPlmn(plmnID *PlmnID) bool {
+	return len(s.plmnIDs) <= 0 || containsPlmn(s.plmnIDs, plmnID)
+}
+
+// isRoamingRequest return true if the request is for a producer in other PLMN
+func (s *OAuthServer) isRoamingRequest(art *AccessTokenRequest) bool {
+	return art.TargetPlmn != nil && !s.isOwnPlmn(art.TargetPlmn)
+}
+
+// isPeerPlmnConsumer return true if the consumer is in a peer PLMN. The consumer
+// is authenticated by the authorization server of its PLMN which forwards the
+// request, so it is not registered in this server. The requesterPlmn is chosen
+// by the client, so it is trusted only if the request is authenticated as
+// forwarded from that peer PLMN
+func (s *OAuthServer) isPeerPlmnConsumer(r *http.Request, art *AccessTokenRequest) bool {
+	if art.RequesterPlmn == nil || s.isOwnPlmn(art.RequesterPlmn) {
+		return false
+	}
+	authenticator, ok := s.peerPlmnAuthenticators[art.RequesterPlmn.String()]
+	if !ok || !authenticator.Authenticate(r) {
+		log.Warn("The request from ", art.NfInstanceID, " is not forwarded by the peer PLMN ", art.RequesterPlmn)
+		return false
+	}
+	return true
+}
+
+// forwardRoamingRequest forward the token request to the authorization server
+// of the target PLMN and reply its response to the consumer. The peer server
+// trusts the consumer authenticated by this server, so only the valid request
+// from a registered consumer of the own PLMNs is forwarded
+func (s *OAuthServer) forwardRoamingRequest(c *gin.Context, art *AccessTokenRequest, b []byte, noCache bool) {
+	if art.RequesterPlmn != nil && !s.isOwnPlmn(art.RequesterPlmn) {
+		log.Error("The requesterPlmn ", art.RequesterPlmn, " of ", art.NfInstanceID, " is not served")
+		c.JSON(http.StatusBadRequest, &AccessTokenError{Error: InvalidRequest, ErrorDescription: "the requesterPlmn is not served"})
+		return
+	}
+	if accessTokenErr := s.checkForwardedRequest(art, false); accessTokenErr != nil {
+		c.JSON(http.StatusBadRequest, accessTokenErr)
+		return
+	}
+	client, ok := s.getPeerPlmnClient(art.TargetPlmn)
+	if !ok {
+		log.Error("No authorization server is configured for the targetPlmn ", art.TargetPlmn)
+		c.JSON(http.StatusBadRequest, &AccessTokenError{Error: InvalidRequest, ErrorDescription: "the targetPlmn is not served"})
+		return
+	}
+	log.Info("Forward the token request from ", art.NfInstanceID, " to the PLMN ", art.TargetPlmn)
+	s.forwardTokenRequest(c, client, b, noCache)
+}
+
+// forwardTokenRequest forward the token request in form encoding to other
+// authorization server by the client and reply its response to the consumer.
+// The AccessTokenError from the other server is replied as it is. The
+// AccessTokenResponse is returned if the token is granted. The other server is
+// asked for a new token if noCache is true
+func (s *OAuthServer) forwardTokenRequest(c *gin.Context, client *OAuthClient, b []byte, noCache bool) *AccessTokenResponse {
+	var r []byte
+	var err error
+	if noCache {
+		r, err = client.RequestNewToken(b)
+	} else {
+		r, err = client.RequestToken(b)
+	}
+	if err != nil {
+		log.Error("Fail to get the token from ", client.serverURL, " with error:", err)
+		var tokenReqErr *TokenRequestError
+		if errors.As(err, &tokenReqErr) && tokenReqErr.AccessTokenError != nil {
+			c.JSON(tokenReqErr.StatusCode, tokenReqErr.AccessTokenError)
+		} else {
+			c.Status(http.StatusServiceUnavailable)
+		}
+		return nil
+	}
+	resp := NewAccessTokenResponse()
+	if err = resp.FromJSON(r); err != nil {
+		log.Error("Fail to decode the token response from ", client.serverURL, " with error:", err)
+		c.Status(http.StatusServiceUnavailable)
+		return nil
+	}
+	replyTokenResponse(c, resp)
+	return resp
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"github.com/lestrrat-go/jwx/jwa"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func createRoamingRequest(targetPlmn *PlmnID) *AccessTokenRequest {
+	req := NewAccessTokenRequest()
+	req.GrantType = "client_credentials"
+	req.NfInstanceID = "5a7bd676-ceeb-44bb-95e0-f6a55a312345"
+	req.NfType = "AMF"
+	req.TargetNfType = "UDM"
+	req.Scope = "nudm-sdm"
+	req.TargetPlmn = targetPlmn
+	return req
+}
+
+func postTokenRequest(t *testing.T, url string, art *AccessTokenRequest) (int, []byte) {
+	b, err := art.ToX3WFormEncoding()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(url, "application/x-www-form-urlencoded", bytes.NewBuffer(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, body
+}
+
+func TestForwardTokenRequestToPeerPlmn(t *testing.T) {
+	key, _ := loadSignatureKey([]byte(privateKey))
+	homePlmn := &PlmnID{Mcc: "460", Mnc: "01"}
+	home := NewOAuthServer("", "home-nrf", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	home.SetPlmnIDs([]*PlmnID{homePlmn})
+	homeServer := httptest.NewServer(home.router)
+	defer homeServer.Close()
+
+	visited := NewOAuthServer("", "visited-nrf", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	visited.SetPlmnIDs([]*PlmnID{&PlmnID{Mcc: "460", Mnc: "00"}})
+	visited.AddPeerPlmn(homePlmn, NewOAuthClient(homeServer.URL+"/oauth2/token", false, nil), nil)
+	visitedServer := httptest.NewServer(visited.router)
+	defer visitedServer.Close()
+
+	code, body := postTokenRequest(t, visitedServer.URL+"/oauth2/token", createRoamingRequest(homePlmn))
+	if code != http.StatusOK {
+		t.Fatal("The request for the peer PLMN should be granted by its server ", code, string(body))
+	}
+	resp := NewAccessTokenResponse()
+	if err := resp.FromJSON(body); err != nil {
+		t.Fatal(err)
+	}
+	claims, err := home.createVerifier().VerifyTokenClaims([]byte(resp.AccessToken))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Iss != "home-nrf" || !homePlmn.Equal(claims.ProducerPlmnID) {
+		t.Error("The token should be issued by the server of the target PLMN ", claims.Iss)
+	}
+
+	// the consumer is not registered in the home PLMN
+	home.SetNFProfileStore(NewNFProfileStore())
+	code, body = postTokenRequest(t, visitedServer.URL+"/oauth2/token", createRoamingRequest(homePlmn))
+	accessTokenErr := &AccessTokenError{}
+	if code != http.StatusBadRequest || accessTokenErr.FromJSON(body) != nil || accessTokenErr.Error != InvalidClient {
+		t.Error("The error of the peer PLMN should be replied as it is ", code, string(body))
+	}
+
+	code, body = postTokenRequest(t, visitedServer.URL+"/oauth2/token", createRoamingRequest(&PlmnID{Mcc: "460", Mnc: "99"}))
+	if code != http.StatusBadRequest || accessTokenErr.FromJSON(body) != nil || accessTokenErr.Error != InvalidRequest {
+		t.Error("The request for the unknown PLMN should be rejected ", code, string(body))
+	}
+}
+
+func TestCheckRoamingRequestBeforeForwarding(t *testing.T) {
+	key, _ := loadSignatureKey([]byte(privateKey))
+	homePlmn := &PlmnID{Mcc: "460", Mnc: "01"}
+	visitedPlmn := &PlmnID{Mcc: "460", Mnc: "00"}
+	forwarded := 0
+	homeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer homeServer.Close()
+
+	visited := NewOAuthServer("", "visited-nrf", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	visited.SetPlmnIDs([]*PlmnID{visitedPlmn})
+	visited.AddPeerPlmn(homePlmn, NewOAuthClient(homeServer.URL+"/oauth2/token", false, nil), nil)
+	store := NewNFProfileStore()
+	store.AddProfile(&NFProfile{NfInstanceID: "8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001", NfType: "AMF"})
+	visited.SetNFProfileStore(store)
+	visitedServer := httptest.NewServer(visited.router)
+	defer visitedServer.Close()
+
+	// the consumer is not registered
+	code, body := postTokenRequest(t, visitedServer.URL+"/oauth2/token", createRoamingRequest(homePlmn))
+	accessTokenErr := &AccessTokenError{}
+	if code != http.StatusBadRequest || accessTokenErr.FromJSON(body) != nil || accessTokenErr.Error != InvalidClient {
+		t.Error("The unregistered consumer should be rejected before forwarding ", code, string(body))
+	}
+
+	req := createRoamingRequest(homePlmn)
+	req.NfInstanceID = "8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001"
+	req.RequesterPlmn = homePlmn
+	code, body = postTokenRequest(t, visitedServer.URL+"/oauth2/token", req)
+	if code != http.StatusBadRequest || accessTokenErr.FromJSON(body) != nil || accessTokenErr.Error != InvalidRequest {
+		t.Error("The requesterPlmn not served should be rejected before forwarding ", code, string(body))
+	}
+
+	req = createRoamingRequest(homePlmn)
+	req.NfInstanceID = "8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001"
+	req.Scope = "unknown-service"
+	code, body = postTokenRequest(t, visitedServer.URL+"/oauth2/token", req)
+	if code != http.StatusBadRequest || accessTokenErr.FromJSON(body) != nil || accessTokenErr.Error != InvalidScope {
+		t.Error("The invalid request should be rejected before forwarding ", code, string(body))
+	}
+	if forwarded != 0 {
+		t.Error("The rejected requests should not be forwarded to the peer PLMN")
+	}
+
+	req = createRoamingRequest(homePlmn)
+	req.NfInstanceID = "8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001"
+	req.RequesterPlmn = visitedPlmn
+	postTokenRequest(t, visitedServer.URL+"/oauth2/token", req)
+	if forwarded != 1 {
+		t.Error("The request of the registered consumer should be forwarded")
+	}
+}
+
+func TestAcceptPeerPlmnConsumer(t *testing.T) {
+	key, _ := loadSignatureKey([]byte(privateKey))
+	homePlmn := &PlmnID{Mcc: "460", Mnc: "01"}
+	peerPlmn := &PlmnID{Mcc: "460", Mnc: "00"}
+	server := NewOAuthServer("", "home-nrf", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	server.SetPlmnIDs([]*PlmnID{homePlmn})
+	server.AddPeerPlmn(peerPlmn, NewOAuthClient("http://127.0.0.1:1", false, nil), NewEndpointAuthenticator(map[string]string{"sepp-46000": "sepp-secret"}, false))
+	server.AddPeerPlmn(&PlmnID{Mcc: "460", Mnc: "02"}, NewOAuthClient("http://127.0.0.1:1", false, nil), NewEndpointAuthenticator(map[string]string{"sepp-46002": "other-secret"}, false))
+	store := NewNFProfileStore()
+	store.AddProfile(&NFProfile{NfInstanceID: "7e8f9a0b-1c2d-4e3f-8a4b-5c6d7e8fd001", NfType: "UDM"})
+	server.SetNFProfileStore(store)
+
+	requestToken := func(art *AccessTokenRequest, clientID string, secret string) (int, []byte) {
+		b, err := art.ToX3WFormEncoding()
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/oauth2/token", bytes.NewBuffer(b))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if len(clientID) > 0 {
+			req.SetBasicAuth(clientID, secret)
+		}
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, req)
+		return w.Code, w.Body.Bytes()
+	}
+
+	req := createRoamingRequest(homePlmn)
+	req.RequesterPlmn = peerPlmn
+	code, body := requestToken(req, "sepp-46000", "sepp-secret")
+	if code != http.StatusOK {
+		t.Fatal("The consumer forwarded by the peer PLMN should be accepted ", code, string(body))
+	}
+	resp := NewAccessTokenResponse()
+	if err := resp.FromJSON(body); err != nil {
+		t.Fatal(err)
+	}
+	claims, _ := server.createVerifier().VerifyTokenClaims([]byte(resp.AccessToken))
+	if !peerPlmn.Equal(claims.ConsumerPlmnID) {
+		t.Error("The PLMN of the consumer should be in the token")
+	}
+
+	// the requesterPlmn is set by the client itself
+	accessTokenErr := &AccessTokenError{}
+	code, body = requestToken(req, "", "")
+	if code != http.StatusBadRequest || accessTokenErr.FromJSON(body) != nil || accessTokenErr.Error != InvalidClient {
+		t.Error("The unauthenticated consumer claiming a peer PLMN should be rejected ", code, string(body))
+	}
+	code, body = requestToken(req, "sepp-46000", "wrong-secret")
+	if code != http.StatusBadRequest || accessTokenErr.FromJSON(body) != nil || accessTokenErr.Error != InvalidClient {
+		t.Error("The consumer with wrong credential of the peer PLMN should be rejected ", code, string(body))
+	}
+	code, body = requestToken(req, "sepp-46002", "other-secret")
+	if code != http.StatusBadRequest || accessTokenErr.FromJSON(body) != nil || accessTokenErr.Error != InvalidClient {
+		t.Error("The request forwarded by other peer PLMN should be rejected ", code, string(body))
+	}
+	if _, accessTokenErr := server.createToken(req); accessTokenErr == nil || accessTokenErr.Error != InvalidClient {
+		t.Error("The requesterPlmn should not be trusted without the forwarding peer PLMN")
+	}
+
+	req = createRoamingRequest(homePlmn)
+	req.RequesterPlmn = &PlmnID{Mcc: "460", Mnc: "99"}
+	if code, body = requestToken(req, "sepp-46000", "sepp-secret"); code != http.StatusBadRequest {
+		t.Error("The unregistered consumer of unknown PLMN should be rejected ", code, string(body))
+	}
+}
+
+func TestPeerPlmnCertificateFqdn(t *testing.T) {
+	cert, err := createTestCertificate(nil, []string{"sepp.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator := NewEndpointAuthenticator(nil, true)
+	authenticator.SetCertificateFqdns([]string{"sepp.peer.example.org"})
+	req := httptest.NewRequest(http.MethodPost, "/oauth2/token", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+	if authenticator.Authenticate(req) {
+		t.Error("The certificate of other FQDN should not be accepted")
+	}
+	authenticator.SetCertificateFqdns([]string{"sepp.peer.example.org", "SEPP.example.com"})
+	if !authenticator.Authenticate(req) {
+		t.Error("The certificate of the SEPP should be accepted")
+	}
+	req.TLS.VerifiedChains = nil
+	if authenticator.Authenticate(req) {
+		t.Error("The certificate not verified should not be accepted")
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+)
+
+// ParseScope split the space-delimited scope defined in RFC 6749 to
+// the list of scope components
+func ParseScope(scope string) []string {
+	return strings.Fields(scope)
+}
+
+// FormatScope join the scope components to a space-delimited scope
+func FormatScope(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// GetScopeServiceName get the service name from a scope component. The scope
+// component is a service name or a resource/operation-level scope in format
+// "<service name>:<resource>[:<operation>]", for example "nudm-sdm:am-data:read"
+func GetScopeServiceName(scope string) string {
+	if pos := strings.Index(scope, ":"); pos >= 0 {
+		return scope[0:pos]
+	}
+	return scope
+}
+
+// IsValidScope return true if the scope component is a valid service name
+// or a resource/operation-level scope of a valid service
+func IsValidScope(scope string) bool {
+	parts := strings.Split(scope, ":")
+	if !IsValidServiceName(parts[0]) {
+		return false
+	}
+	for _, part := range parts[1:] {
+		if len(part) <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// IsScopeCoveredBy return true if the scope component is granted by the
+// granted scope component. A service name covers all the resource/operation-level
+// scopes of the service and a resource-level scope covers all its operations
+func IsScopeCoveredBy(scope string, granted string) bool {
+	return scope == granted || strings.HasPrefix(scope, granted+":")
+}
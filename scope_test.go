@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseScope(t *testing.T) {
+	scopes := ParseScope(" namf-comm  namf-evts nudm-sdm:am-data:read ")
+	if len(scopes) != 3 || scopes[2] != "nudm-sdm:am-data:read" {
+		t.Fail()
+	}
+	if FormatScope(scopes) != "namf-comm namf-evts nudm-sdm:am-data:read" {
+		t.Fail()
+	}
+	if GetScopeServiceName(scopes[2]) != "nudm-sdm" {
+		t.Fail()
+	}
+}
+
+func TestIsValidScope(t *testing.T) {
+	for _, scope := range []string{"namf-comm", "nudm-sdm:am-data", "nudm-sdm:am-data:read"} {
+		if !IsValidScope(scope) {
+			t.Errorf("%s should be valid", scope)
+		}
+	}
+	for _, scope := range []string{"NMF", "nudm-sdm:", "nudm-sdm::read", "unknown:am-data"} {
+		if IsValidScope(scope) {
+			t.Errorf("%s should be invalid", scope)
+		}
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	atc := NewAccessTokenClaims()
+	atc.Scope = "namf-comm nudm-sdm:am-data"
+	if !atc.HasScope("namf-comm") || !atc.HasScope("namf-comm:ue-contexts:read nudm-sdm:am-data:read") {
+		t.Fail()
+	}
+	if atc.HasScope("namf-evts") || atc.HasScope("nudm-sdm") || atc.HasScope("nudm-sdm:sm-data") {
+		t.Fail()
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/lestrrat-go/jwx/jwa"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// the well-known path of the authorization server metadata defined in RFC 8414
+const authServerMetadataPath = "/.well-known/oauth-authorization-server"
+
+// the asymmetric signature algorithms accepted in the client credentials assertion
+var clientAssertionAlgorithms = []string{"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA"}
+
+// AuthServerMetadata the authorization server metadata defined in RFC 8414
+type AuthServerMetadata struct {
+	Issuer                                     string   `json:"issuer"`
+	TokenEndpoint                              string   `json:"token_endpoint"`
+	JwksURI                                    string   `json:"jwks_uri,omitempty"`
+	GrantTypesSupported                        []string `json:"grant_types_supported"`
+	TokenEndpointAuthMethodsSupported          []string `json:"token_endpoint_auth_methods_supported"`
+	TokenEndpointAuthSigningAlgValuesSupported []string `json:"token_endpoint_auth_signing_alg_values_supported,omitempty"`
+	IntrospectionEndpoint                      string   `json:"introspection_endpoint,omitempty"`
+	IntrospectionEndpointAuthMethodsSupported  []string `json:"introspection_endpoint_auth_methods_supported,omitempty"`
+	RevocationEndpoint                         string   `json:"revocation_endpoint,omitempty"`
+	RevocationEndpointAuthMethodsSupported     []string `json:"revocation_endpoint_auth_methods_supported,omitempty"`
+	// RFC 8705, the token is bound to the client certificate
+	TLSClientCertificateBoundAccessTokens bool `json:"tls_client_certificate_bound_access_tokens,omitempty"`
+	// the algorithms to sign the access token, not defined in RFC 8414
+	AccessTokenSigningAlgValuesSupported []string `json:"access_token_signing_alg_values_supported"`
+}
+
+// GetAccessTokenSigningAlgorithm get the algorithm to sign the access token
+func (m *AuthServerMetadata) GetAccessTokenSigningAlgorithm() (jwa.SignatureAlgorithm, error) {
+	if len(m.AccessTokenSigningAlgValuesSupported) <= 0 {
+		return "", fmt.Errorf("No access token signing algorithm in the metadata of %s", m.Issuer)
+	}
+	return jwa.SignatureAlgorithm(m.AccessTokenSigningAlgValuesSupported[0]), nil
+}
+
+// EnableMetadata publish the authorization server metadata in the well-known
+// path. The issuer is the base URL of the server, for example
+// https://nrf.example.com, and it is derived from the request if it is empty
+func (s *OAuthServer) EnableMetadata(issuer string) {
+	s.router.GET(authServerMetadataPath, func(c *gin.Context) {
+		baseURL := strings.TrimSuffix(issuer, "/")
+		if len(baseURL) <= 0 {
+			scheme := "http"
+			if c.Request.TLS != nil {
+				scheme = "https"
+			}
+			baseURL = scheme + "://" + c.Request.Host
+		}
+		c.JSON(http.StatusOK, s.createMetadata(baseURL))
+	})
+}
+
+func (s *OAuthServer) createMetadata(baseURL string) *AuthServerMetadata {
+	alg := s.keyManager.GetAlgorithm()
+	metadata := &AuthServerMetadata{Issuer: baseURL,
+		TokenEndpoint:                        baseURL + s.tokenReqPath,
+		GrantTypesSupported:                  []string{"client_credentials"},
+		TokenEndpointAuthMethodsSupported:    make([]string, 0),
+		AccessTokenSigningAlgValuesSupported: []string{alg.String()}}
+	// the symmetric keys are never published
+	if len(s.jwksPath) > 0 && !isSymmetricAlgorithm(alg) {
+		metadata.JwksURI = baseURL + s.jwksPath
+	}
+	if s.clientAssertionVerifier == nil || !s.clientAssertionRequired {
+		metadata.TokenEndpointAuthMethodsSupported = append(metadata.TokenEndpointAuthMethodsSupported, "none")
+	}
+	if s.clientAssertionVerifier != nil {
+		metadata.TokenEndpointAuthMethodsSupported = append(metadata.TokenEndpointAuthMethodsSupported, "private_key_jwt")
+		metadata.TokenEndpointAuthSigningAlgValuesSupported = clientAssertionAlgorithms
+	}
+	if len(s.clientCAFile) > 0 {
+		metadata.TokenEndpointAuthMethodsSupported = append(metadata.TokenEndpointAuthMethodsSupported, "tls_client_auth")
+		metadata.TLSClientCertificateBoundAccessTokens = s.certificateBoundToken
+	}
+	if len(s.introspectionPath) > 0 {
+		metadata.IntrospectionEndpoint = baseURL + s.introspectionPath
+		metadata.IntrospectionEndpointAuthMethodsSupported = s.introspectionAuthenticator.getAuthMethods()
+	}
+	if len(s.revocationPath) > 0 {
+		metadata.RevocationEndpoint = baseURL + s.revocationPath
+		metadata.RevocationEndpointAuthMethodsSupported = s.revocationAuthenticator.getAuthMethods()
+	}
+	return metadata
+}
+
+// getAuthServerMetadataURL get the URL of the metadata of the issuer. The
+// well-known path is inserted between the host and the path of the issuer
+// as defined in RFC 8414
+func getAuthServerMetadataURL(issuer string) (string, error) {
+	u, err := url.Parse(issuer)
+	if err != nil {
+		return "", err
+	}
+	if len(u.Scheme) <= 0 || len(u.Host) <= 0 {
+		return "", fmt.Errorf("Invalid issuer %s", issuer)
+	}
+	u.Path = authServerMetadataPath + strings.TrimSuffix(u.Path, "/")
+	return u.String(), nil
+}
+
+// FetchAuthServerMetadata get the metadata of the authorization server with
+// the issuer, the base URL of the server. The issuer in the metadata must be
+// same as the requested issuer
+func FetchAuthServerMetadata(client *OAuthClient, issuer string) (*AuthServerMetadata, error) {
+	metadataURL, err := getAuthServerMetadataURL(issuer)
+	if err != nil {
+		return nil, err
+	}
+	b, err := client.Get(metadataURL)
+	if err != nil {
+		return nil, err
+	}
+	metadata := &AuthServerMetadata{}
+	if err = json.Unmarshal(b, metadata); err != nil {
+		return nil, err
+	}
+	if metadata.Issuer != strings.TrimSuffix(issuer, "/") {
+		return nil, fmt.Errorf("The issuer %s in metadata does not match %s", metadata.Issuer, issuer)
+	}
+	if len(metadata.TokenEndpoint) <= 0 {
+		return nil, fmt.Errorf("No token endpoint in the metadata of %s", issuer)
+	}
+	return metadata, nil
+}
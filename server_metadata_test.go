@@ -0,0 +1,68 @@
+package main
+
+import (
+	"github.com/lestrrat-go/jwx/jwa"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAuthServerMetadata(t *testing.T) {
+	key, _ := loadSignatureKey([]byte(privateKey))
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	server.EnableJWKS("/oauth2/jwks")
+	server.EnableClientAssertion(true, 0)
+	server.EnableIntrospection("/oauth2/introspect", NewEndpointAuthenticator(map[string]string{"amf": "amf-secret"}, true))
+	server.EnableRevocation("/oauth2/revoke", NewEndpointAuthenticator(map[string]string{"amf": "amf-secret"}, false))
+	server.EnableMetadata("")
+	ts := httptest.NewServer(server.router)
+	defer ts.Close()
+
+	metadata, err := FetchAuthServerMetadata(NewOAuthClient(ts.URL, false, nil), ts.URL+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Issuer != ts.URL || metadata.TokenEndpoint != ts.URL+"/oauth2/token" || metadata.JwksURI != ts.URL+"/oauth2/jwks" {
+		t.Error("Unexpected endpoints in metadata ", metadata)
+	}
+	if metadata.IntrospectionEndpoint != ts.URL+"/oauth2/introspect" || len(metadata.IntrospectionEndpointAuthMethodsSupported) != 2 {
+		t.Error("Unexpected introspection endpoint in metadata ", metadata)
+	}
+	if metadata.RevocationEndpoint != ts.URL+"/oauth2/revoke" || len(metadata.RevocationEndpointAuthMethodsSupported) != 1 {
+		t.Error("Unexpected revocation endpoint in metadata ", metadata)
+	}
+	if len(metadata.TokenEndpointAuthMethodsSupported) != 1 || metadata.TokenEndpointAuthMethodsSupported[0] != "private_key_jwt" {
+		t.Error("Only private_key_jwt should be supported if the client assertion is required")
+	}
+	if alg, err := metadata.GetAccessTokenSigningAlgorithm(); err != nil || alg != jwa.RS256 {
+		t.Error("Unexpected access token signing algorithm")
+	}
+
+	if _, err = FetchAuthServerMetadata(NewOAuthClient(ts.URL, false, nil), "http://nrf.example.com"); err == nil {
+		t.Error("The metadata with different issuer should be rejected")
+	}
+}
+
+func TestAuthServerMetadataHMAC(t *testing.T) {
+	server := NewOAuthServer("/token", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.HS256, []byte("0123456789abcdef0123456789abcdef"))
+	server.EnableJWKS("/oauth2/jwks")
+	metadata := server.createMetadata("https://nrf.example.com")
+	if len(metadata.JwksURI) > 0 || metadata.TokenEndpoint != "https://nrf.example.com/token" {
+		t.Error("Unexpected metadata of HMAC server ", metadata)
+	}
+	if len(metadata.TokenEndpointAuthMethodsSupported) != 1 || metadata.TokenEndpointAuthMethodsSupported[0] != "none" {
+		t.Error("Unexpected token endpoint auth methods ", metadata.TokenEndpointAuthMethodsSupported)
+	}
+}
+
+func TestGetAuthServerMetadataURL(t *testing.T) {
+	if u, err := getAuthServerMetadataURL("https://nrf.example.com"); err != nil || u != "https://nrf.example.com/.well-known/oauth-authorization-server" {
+		t.Error("Unexpected metadata URL ", u)
+	}
+	if u, err := getAuthServerMetadataURL("https://nrf.example.com/plmn1/"); err != nil || u != "https://nrf.example.com/.well-known/oauth-authorization-server/plmn1" {
+		t.Error("Unexpected metadata URL ", u)
+	}
+	if _, err := getAuthServerMetadataURL("nrf.example.com"); err == nil {
+		t.Error("The issuer without scheme should be rejected")
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwt"
+	"math/big"
+	"strings"
+)
+
+// Signer signs the token with a key which may be kept outside the process,
+// for example in a HSM or a remote signing service
+type Signer interface {
+	// Algorithm get the JWS signature algorithm of the signer
+	Algorithm() jwa.SignatureAlgorithm
+	// Public get the public key to verify the signature, nil for the symmetric key
+	Public() crypto.PublicKey
+	// Sign sign the JWS signing input and return the JWS signature
+	Sign(signingInput []byte) ([]byte, error)
+}
+
+// KeySigner a Signer with the in-memory private key or HMAC secret
+type KeySigner struct {
+	alg jwa.SignatureAlgorithm
+	key interface{}
+}
+
+// NewKeySigner create a KeySigner with the private key or the HMAC secret
+func NewKeySigner(alg jwa.SignatureAlgorithm, key interface{}) *KeySigner {
+	return &KeySigner{alg: alg, key: key}
+}
+
+// Algorithm get the signature algorithm
+func (ks *KeySigner) Algorithm() jwa.SignatureAlgorithm {
+	return ks.alg
+}
+
+// Public get the public key of the private key
+func (ks *KeySigner) Public() crypto.PublicKey {
+	switch k := ks.key.(type) {
+	case []byte:
+		return nil
+	case crypto.Signer:
+		return k.Public()
+	}
+	return ks.key
+}
+
+// Sign sign the JWS signing input with the key
+func (ks *KeySigner) Sign(signingInput []byte) ([]byte, error) {
+	switch k := ks.key.(type) {
+	case []byte:
+		hash, err := getAlgorithmHash(ks.alg)
+		if err != nil {
+			return nil, err
+		}
+		mac := hmac.New(hash.New, k)
+		mac.Write(signingInput)
+		return mac.Sum(nil), nil
+	case crypto.Signer:
+		return signWithCryptoSigner(ks.alg, k, signingInput)
+	}
+	return nil, fmt.Errorf("Can't sign with key %T", ks.key)
+}
+
+// CryptoSigner a Signer with a crypto.Signer, for example a key in HSM
+type CryptoSigner struct {
+	alg    jwa.SignatureAlgorithm
+	signer crypto.Signer
+}
+
+// NewCryptoSigner create a CryptoSigner with the RSA, ECDSA or Ed25519 crypto.Signer
+func NewCryptoSigner(alg jwa.SignatureAlgorithm, signer crypto.Signer) *CryptoSigner {
+	return &CryptoSigner{alg: alg, signer: signer}
+}
+
+// Algorithm get the signature algorithm
+func (cs *CryptoSigner) Algorithm() jwa.SignatureAlgorithm {
+	return cs.alg
+}
+
+// Public get the public key of the crypto.Signer
+func (cs *CryptoSigner) Public() crypto.PublicKey {
+	return cs.signer.Public()
+}
+
+// Sign sign the JWS signing input with the crypto.Signer
+func (cs *CryptoSigner) Sign(signingInput []byte) ([]byte, error) {
+	return signWithCryptoSigner(cs.alg, cs.signer, signingInput)
+}
+
+// getAlgorithmHash get the hash function of the RSA, ECDSA or HMAC algorithm
+func getAlgorithmHash(alg jwa.SignatureAlgorithm) (crypto.Hash, error) {
+	switch {
+	case strings.HasSuffix(alg.String(), "256"):
+		return crypto.SHA256, nil
+	case strings.HasSuffix(alg.String(), "384"):
+		return crypto.SHA384, nil
+	case strings.HasSuffix(alg.String(), "512"):
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("No hash function for signature algorithm %s", alg)
+}
+
+// signWithCryptoSigner create the JWS signature defined in RFC 7518 with
+// the crypto.Signer
+func signWithCryptoSigner(alg jwa.SignatureAlgorithm, signer crypto.Signer, signingInput []byte) ([]byte, error) {
+	if alg == jwa.EdDSA {
+		return signer.Sign(rand.Reader, signingInput, crypto.Hash(0))
+	}
+	hash, err := getAlgorithmHash(alg)
+	if err != nil {
+		return nil, err
+	}
+	h := hash.New()
+	h.Write(signingInput)
+	digest := h.Sum(nil)
+	switch {
+	case strings.HasPrefix(alg.String(), "RS"):
+		return signer.Sign(rand.Reader, digest, hash)
+	case strings.HasPrefix(alg.String(), "PS"):
+		return signer.Sign(rand.Reader, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash})
+	case strings.HasPrefix(alg.String(), "ES"):
+		publicKey, ok := signer.Public().(*ecdsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("The key %T can't be used with signature algorithm %s", signer.Public(), alg)
+		}
+		der, err := signer.Sign(rand.Reader, digest, hash)
+		if err != nil {
+			return nil, err
+		}
+		return convertECDSASignature(der, (publicKey.Curve.Params().BitSize+7)/8)
+	}
+	return nil, fmt.Errorf("Unsupported signature algorithm %s", alg)
+}
+
+// convertECDSASignature convert the ASN.1 DER ECDSA signature to the fixed
+// length R||S format used by JWS
+func convertECDSASignature(der []byte, keySize int) ([]byte, error) {
+	var sig struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(der, &sig); err != nil {
+		return nil, err
+	}
+	r := sig.R.Bytes()
+	s := sig.S.Bytes()
+	if len(r) > keySize || len(s) > keySize {
+		return nil, fmt.Errorf("Invalid ECDSA signature")
+	}
+	result := make([]byte, 2*keySize)
+	copy(result[keySize-len(r):keySize], r)
+	copy(result[2*keySize-len(s):], s)
+	return result, nil
+}
+
+// signJWT create the compact serialization of the signed JWT with the kid
+// in the header if it is not empty
+func signJWT(token jwt.Token, signer Signer, keyID string) (string, error) {
+	header := map[string]string{"alg": signer.Algorithm().String(), "typ": "JWT"}
+	if len(keyID) > 0 {
+		header["kid"] = keyID
+	}
+	b, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(b) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature, err := signer.Sign([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
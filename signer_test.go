@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/lestrrat-go/jwx/jwa"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// opaqueSigner hides the private key behind crypto.Signer like a HSM
+type opaqueSigner struct {
+	signer crypto.Signer
+}
+
+func (s *opaqueSigner) Public() crypto.PublicKey {
+	return s.signer.Public()
+}
+
+func (s *opaqueSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.signer.Sign(rand, digest, opts)
+}
+
+func TestCryptoSigner(t *testing.T) {
+	for _, alg := range []jwa.SignatureAlgorithm{jwa.RS256, jwa.PS384, jwa.ES256, jwa.ES512, jwa.EdDSA} {
+		key, _ := generateSigningKey(alg)
+		signer := NewCryptoSigner(alg, &opaqueSigner{signer: key.(crypto.Signer)})
+		server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", alg, nil)
+		if err := server.SetSigner(signer); err != nil {
+			t.Fatal(err)
+		}
+		if server.EnableKeyRotation(0, 0, "") == nil {
+			t.Error("The key in external signer should not be rotated")
+		}
+		token, err := createTokenWithServer(server)
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+		if err = NewAccessTokenVerifier(alg, signer.Public()).VerifyToken([]byte(token)); err != nil {
+			t.Error(alg, err)
+		}
+	}
+}
+
+func TestRemoteSigner(t *testing.T) {
+	key, _ := generateSigningKey(jwa.ES384)
+	keySigner := NewKeySigner(jwa.ES384, key)
+	signService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &RemoteSignRequest{}
+		json.NewDecoder(r.Body).Decode(req)
+		data, err := base64.RawURLEncoding.DecodeString(req.Data)
+		if err != nil || req.Algorithm != "ES384" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		signature, _ := keySigner.Sign(data)
+		json.NewEncoder(w).Encode(&RemoteSignResponse{Signature: base64.RawURLEncoding.EncodeToString(signature)})
+	}))
+	defer signService.Close()
+
+	signer := NewRemoteSigner(jwa.ES384, signService.URL, NewOAuthClient(signService.URL, false, nil), keySigner.Public())
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.ES384, nil)
+	if err := server.SetSigner(signer); err != nil {
+		t.Fatal(err)
+	}
+	token, err := createTokenWithServer(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = NewAccessTokenVerifier(jwa.ES384, signer.Public()).VerifyToken([]byte(token)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConvertECDSASignature(t *testing.T) {
+	// SEQUENCE { INTEGER 1, INTEGER 2 }
+	sig, err := convertECDSASignature([]byte{0x30, 0x06, 0x02, 0x01, 0x01, 0x02, 0x01, 0x02}, 4)
+	if err != nil || len(sig) != 8 || sig[3] != 1 || sig[7] != 2 {
+		t.Fail()
+	}
+	if _, err = convertECDSASignature([]byte{0x30, 0x06, 0x02, 0x01, 0x01, 0x02, 0x01, 0x02}, 0); err == nil {
+		t.Fail()
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SigningKeyActive the key is used to sign the token
+	SigningKeyActive string = "active"
+	// SigningKeyNext the key will be used after next rotation, it is published
+	// in advance so the verifiers know it before it is used
+	SigningKeyNext string = "next"
+	// SigningKeyRetired the key is not used to sign the token anymore but it is
+	// published until the tokens signed by it are expired
+	SigningKeyRetired string = "retired"
+)
+
+// SigningKey the key to sign the token
+type SigningKey struct {
+	KeyID  string
+	Signer Signer
+	State  string
+	// the time when the key is retired
+	RetiredAt time.Time
+}
+
+// SigningKeyManager manages the active, next and retired signing keys. The
+// token is signed only with the active key and all the non-expired keys are
+// published in the JWK set
+type SigningKeyManager struct {
+	sync.Mutex
+	active  *SigningKey
+	next    *SigningKey
+	retired []*SigningKey
+	// how long a retired key is published, must not be less than the token
+	// expire duration
+	overlap time.Duration
+	// the JWK set file to keep the keys over restart
+	stateFile string
+}
+
+// NewSigningKeyManager create a SigningKeyManager with the active key. The
+// retired keys are published in the overlap duration after retired
+func NewSigningKeyManager(alg jwa.SignatureAlgorithm, key interface{}, keyID string, overlap time.Duration) *SigningKeyManager {
+	return NewSigningKeyManagerWithSigner(NewKeySigner(alg, key), keyID, overlap)
+}
+
+// NewSigningKeyManagerWithSigner create a SigningKeyManager with the signer
+// of the active key
+func NewSigningKeyManagerWithSigner(signer Signer, keyID string, overlap time.Duration) *SigningKeyManager {
+	return &SigningKeyManager{active: &SigningKey{KeyID: keyID, Signer: signer, State: SigningKeyActive},
+		retired: make([]*SigningKey, 0),
+		overlap: overlap}
+}
+
+// GetAlgorithm get the signature algorithm of the keys
+func (skm *SigningKeyManager) GetAlgorithm() jwa.SignatureAlgorithm {
+	return skm.GetActiveKey().Signer.Algorithm()
+}
+
+// GetActiveKey get the active key to sign the token
+func (skm *SigningKeyManager) GetActiveKey() *SigningKey {
+	skm.Lock()
+	defer skm.Unlock()
+	return skm.active
+}
+
+// SetActiveKeyID change the key id of the active key
+func (skm *SigningKeyManager) SetActiveKeyID(keyID string) {
+	skm.Lock()
+	defer skm.Unlock()
+	skm.active = &SigningKey{KeyID: keyID, Signer: skm.active.Signer, State: SigningKeyActive}
+}
+
+// SetActiveSigner replace the active key with the key of the signer
+func (skm *SigningKeyManager) SetActiveSigner(signer Signer, keyID string) {
+	skm.Lock()
+	defer skm.Unlock()
+	skm.active = &SigningKey{KeyID: keyID, Signer: signer, State: SigningKeyActive}
+}
+
+// PrepareNextKey generate the next key if there is no next key
+func (skm *SigningKeyManager) PrepareNextKey() error {
+	skm.Lock()
+	defer skm.Unlock()
+	if err := skm.prepareNextKey(); err != nil {
+		return err
+	}
+	return skm.saveState()
+}
+
+func (skm *SigningKeyManager) prepareNextKey() error {
+	if skm.next != nil {
+		return nil
+	}
+	// the keys kept outside the process can't be generated
+	if _, ok := skm.active.Signer.(*KeySigner); !ok {
+		return fmt.Errorf("The signing key of %T can't be rotated", skm.active.Signer)
+	}
+	alg := skm.active.Signer.Algorithm()
+	key, err := generateSigningKey(alg)
+	if err != nil {
+		return err
+	}
+	keyID, err := getKeyThumbprint(key)
+	if err != nil {
+		return err
+	}
+	skm.next = &SigningKey{KeyID: keyID, Signer: NewKeySigner(alg, key), State: SigningKeyNext}
+	log.Info("Prepare the next signing key ", keyID)
+	return nil
+}
+
+// Rotate retire the active key, make the next key active and prepare
+// a new next key
+func (skm *SigningKeyManager) Rotate() error {
+	skm.Lock()
+	defer skm.Unlock()
+
+	if err := skm.prepareNextKey(); err != nil {
+		return err
+	}
+	skm.retired = append(skm.retired, &SigningKey{KeyID: skm.active.KeyID,
+		Signer:    skm.active.Signer,
+		State:     SigningKeyRetired,
+		RetiredAt: time.Now()})
+	skm.active = &SigningKey{KeyID: skm.next.KeyID, Signer: skm.next.Signer, State: SigningKeyActive}
+	skm.next = nil
+	log.Info("Rotate the signing key to ", skm.active.KeyID)
+	if err := skm.prepareNextKey(); err != nil {
+		return err
+	}
+	return skm.saveState()
+}
+
+// SetStateFile keep the active, next and retired keys in the JWK set file
+// so the tokens signed before the restart can still be verified. If the file
+// exists, its keys replace the current keys
+func (skm *SigningKeyManager) SetStateFile(fileName string) error {
+	skm.Lock()
+	defer skm.Unlock()
+	skm.stateFile = fileName
+	b, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return skm.saveState()
+	}
+	if err != nil {
+		return err
+	}
+	return skm.loadState(b)
+}
+
+func (skm *SigningKeyManager) loadState(b []byte) error {
+	keySet, err := jwk.ParseBytes(b)
+	if err != nil {
+		return err
+	}
+	alg := skm.active.Signer.Algorithm()
+	var active, next *SigningKey
+	retired := make([]*SigningKey, 0)
+	for _, k := range keySet.Keys {
+		if k.Algorithm() != alg.String() {
+			return fmt.Errorf("The algorithm %s of key %s does not match %s", k.Algorithm(), k.KeyID(), alg)
+		}
+		var key interface{}
+		if err = k.Raw(&key); err != nil {
+			return err
+		}
+		signingKey := &SigningKey{KeyID: k.KeyID(), Signer: NewKeySigner(alg, key)}
+		state, _ := k.Get("state")
+		signingKey.State, _ = state.(string)
+		switch signingKey.State {
+		case SigningKeyActive:
+			active = signingKey
+		case SigningKeyNext:
+			next = signingKey
+		case SigningKeyRetired:
+			retiredAt, _ := k.Get("retiredAt")
+			if t, ok := retiredAt.(float64); ok {
+				signingKey.RetiredAt = time.Unix(int64(t), 0)
+			}
+			retired = append(retired, signingKey)
+		default:
+			return fmt.Errorf("Invalid state %v of key %s", state, k.KeyID())
+		}
+	}
+	if active == nil {
+		return fmt.Errorf("No active key in %s", skm.stateFile)
+	}
+	skm.active, skm.next, skm.retired = active, next, retired
+	log.Info("Load the signing keys from ", skm.stateFile, ", the active key is ", active.KeyID)
+	return nil
+}
+
+// saveState write the keys to the state file if it is set, the file is
+// replaced atomically and readable only by the owner
+func (skm *SigningKeyManager) saveState() error {
+	if len(skm.stateFile) <= 0 {
+		return nil
+	}
+	keys := make([]jwk.Key, 0)
+	all := append([]*SigningKey{skm.active}, skm.retired...)
+	if skm.next != nil {
+		all = append(all, skm.next)
+	}
+	for _, signingKey := range all {
+		keySigner, ok := signingKey.Signer.(*KeySigner)
+		if !ok {
+			return fmt.Errorf("The signing key of %T can't be saved", signingKey.Signer)
+		}
+		k, err := jwk.New(keySigner.key)
+		if err != nil {
+			return err
+		}
+		k.Set(jwk.KeyIDKey, signingKey.KeyID)
+		k.Set(jwk.AlgorithmKey, keySigner.alg.String())
+		k.Set("state", signingKey.State)
+		if signingKey.State == SigningKeyRetired {
+			k.Set("retiredAt", signingKey.RetiredAt.Unix())
+		}
+		keys = append(keys, k)
+	}
+	b, err := json.Marshal(map[string][]jwk.Key{"keys": keys})
+	if err != nil {
+		return err
+	}
+	tmpFile := skm.stateFile + ".tmp"
+	if err = ioutil.WriteFile(tmpFile, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, skm.stateFile)
+}
+
+// StartRotation rotate the keys periodically in background
+func (skm *SigningKeyManager) StartRotation(interval time.Duration) {
+	go func() {
+		for {
+			time.Sleep(interval)
+			if err := skm.Rotate(); err != nil {
+				log.Error("Fail to rotate the signing key with error:", err)
+			}
+		}
+	}()
+}
+
+// GetPublishedKeys get the active, next and the retired keys in overlap duration
+func (skm *SigningKeyManager) GetPublishedKeys() []*SigningKey {
+	skm.Lock()
+	defer skm.Unlock()
+
+	retired := make([]*SigningKey, 0)
+	for _, key := range skm.retired {
+		if time.Since(key.RetiredAt) < skm.overlap {
+			retired = append(retired, key)
+		}
+	}
+	skm.retired = retired
+
+	keys := []*SigningKey{skm.active}
+	if skm.next != nil {
+		keys = append(keys, skm.next)
+	}
+	return append(keys, retired...)
+}
+
+// GetKey get the key to verify the token signed by the published key with the
+// kid, so the SigningKeyManager is a VerificationKeySource of its own tokens
+func (skm *SigningKeyManager) GetKey(kid string) (jwa.SignatureAlgorithm, interface{}, error) {
+	for _, key := range skm.GetPublishedKeys() {
+		if key.KeyID != kid {
+			continue
+		}
+		alg := key.Signer.Algorithm()
+		if keySigner, ok := key.Signer.(*KeySigner); ok && isSymmetricAlgorithm(alg) {
+			return alg, keySigner.key, nil
+		}
+		return alg, key.Signer.Public(), nil
+	}
+	return "", nil, fmt.Errorf("No signing key with kid %s", kid)
+}
+
+// generateSigningKey generate a new private key for the signature algorithm
+func generateSigningKey(alg jwa.SignatureAlgorithm) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(alg.String(), "RS") || strings.HasPrefix(alg.String(), "PS"):
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case alg == jwa.ES256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case alg == jwa.ES384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case alg == jwa.ES512:
+		return ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case alg == jwa.EdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return nil, fmt.Errorf("Can't generate key for algorithm %s", alg)
+}
+
+// checkSignatureKey check if the private or public key can be used with the
+// signature algorithm
+func checkSignatureKey(alg jwa.SignatureAlgorithm, key interface{}) error {
+	switch alg {
+	case jwa.RS256, jwa.RS384, jwa.RS512, jwa.PS256, jwa.PS384, jwa.PS512:
+		switch key.(type) {
+		case *rsa.PrivateKey, *rsa.PublicKey:
+			return nil
+		}
+	case jwa.ES256, jwa.ES384, jwa.ES512:
+		var curve elliptic.Curve
+		switch k := key.(type) {
+		case *ecdsa.PrivateKey:
+			curve = k.Curve
+		case *ecdsa.PublicKey:
+			curve = k.Curve
+		default:
+			return fmt.Errorf("The key %T can't be used with signature algorithm %s", key, alg)
+		}
+		expected := map[jwa.SignatureAlgorithm]elliptic.Curve{jwa.ES256: elliptic.P256(),
+			jwa.ES384: elliptic.P384(),
+			jwa.ES512: elliptic.P521()}[alg]
+		if curve != expected {
+			return fmt.Errorf("The curve %s of the key can't be used with signature algorithm %s", curve.Params().Name, alg)
+		}
+		return nil
+	case jwa.EdDSA:
+		switch key.(type) {
+		case ed25519.PrivateKey, ed25519.PublicKey:
+			return nil
+		}
+	case jwa.HS256, jwa.HS384, jwa.HS512:
+		secret, ok := key.([]byte)
+		if !ok {
+			break
+		}
+		// RFC 7518 section 3.2 requires the key size is not less than the hash output size
+		minSize := map[jwa.SignatureAlgorithm]int{jwa.HS256: 32, jwa.HS384: 48, jwa.HS512: 64}[alg]
+		if len(secret) < minSize {
+			return fmt.Errorf("The secret of signature algorithm %s must have at least %d bytes", alg, minSize)
+		}
+		return nil
+	default:
+		return fmt.Errorf("Unsupported signature algorithm %s", alg)
+	}
+	return fmt.Errorf("The key %T can't be used with signature algorithm %s", key, alg)
+}
+
+// isSymmetricAlgorithm return true if the signature algorithm uses a shared
+// secret which must not be published
+func isSymmetricAlgorithm(alg jwa.SignatureAlgorithm) bool {
+	return strings.HasPrefix(alg.String(), "HS")
+}
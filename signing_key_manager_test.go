@@ -0,0 +1,189 @@
+package main
+
+import (
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSigningKeyRotation(t *testing.T) {
+	key, err := generateSigningKey(jwa.ES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := NewSigningKeyManager(jwa.ES256, key, "key-1", time.Hour)
+	if err = manager.PrepareNextKey(); err != nil {
+		t.Fatal(err)
+	}
+	next := manager.GetPublishedKeys()[1]
+	if next.State != SigningKeyNext {
+		t.Fail()
+	}
+	if err = manager.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if manager.GetActiveKey().KeyID != next.KeyID {
+		t.Fail()
+	}
+	keys := manager.GetPublishedKeys()
+	if len(keys) != 3 || keys[2].KeyID != "key-1" || keys[2].State != SigningKeyRetired {
+		t.Fatal("Unexpected published keys ", keys)
+	}
+	manager.overlap = 0
+	if len(manager.GetPublishedKeys()) != 2 {
+		t.Fail()
+	}
+}
+
+func TestVerifyTokenAfterRotation(t *testing.T) {
+	key, _ := loadSignatureKey([]byte(privateKey))
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	server.EnableJWKS("/oauth2/jwks")
+	if err := server.EnableKeyRotation(0, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	oldToken, _ := createTokenWithServer(server)
+	if err := server.keyManager.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	server.tokenCache = NewTokenCache(0)
+	newToken, _ := createTokenWithServer(server)
+
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/oauth2/jwks", nil))
+	keySet, err := jwk.ParseBytes(w.Body.Bytes())
+	if err != nil || len(keySet.Keys) != 3 {
+		t.Fatal("Invalid JWKS ", w.Body.String())
+	}
+	for _, token := range []string{oldToken, newToken} {
+		verifier := NewAccessTokenVerifierWithKeySource(jwa.RS256, NewKeySetSource(keySet))
+		if err = verifier.VerifyToken([]byte(token)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestSigningKeyStateFile(t *testing.T) {
+	key, _ := loadSignatureKey([]byte(privateKey))
+	stateFile := filepath.Join(t.TempDir(), "signing-keys.json")
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	if err := server.EnableKeyRotation(0, 0, stateFile); err != nil {
+		t.Fatal(err)
+	}
+	oldToken, _ := createTokenWithServer(server)
+	if err := server.keyManager.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	server.tokenCache = NewTokenCache(0)
+	newToken, _ := createTokenWithServer(server)
+	keys := server.keyManager.GetPublishedKeys()
+
+	// restart with the same configured key
+	restarted := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	if err := restarted.EnableKeyRotation(0, 0, stateFile); err != nil {
+		t.Fatal(err)
+	}
+	restartedKeys := restarted.keyManager.GetPublishedKeys()
+	if len(restartedKeys) != len(keys) {
+		t.Fatal("The keys should be restored from the state file")
+	}
+	for i, k := range keys {
+		if restartedKeys[i].KeyID != k.KeyID || restartedKeys[i].State != k.State {
+			t.Errorf("Expect key %s in state %s but get %s in state %s", k.KeyID, k.State, restartedKeys[i].KeyID, restartedKeys[i].State)
+		}
+	}
+	if restartedKeys[2].RetiredAt.Unix() != keys[2].RetiredAt.Unix() {
+		t.Error("The retired time should be restored")
+	}
+	for _, token := range []string{oldToken, newToken} {
+		if _, err := restarted.createVerifier().VerifyTokenClaims([]byte(token)); err != nil {
+			t.Error("The token issued before restart should be verified ", err)
+		}
+	}
+	restartedToken, _ := createTokenWithServer(restarted)
+	if _, err := server.createVerifier().VerifyTokenClaims([]byte(restartedToken)); err != nil {
+		t.Error("The restarted server should sign with the rotated key ", err)
+	}
+
+	es256Key, _ := generateSigningKey(jwa.ES256)
+	other := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.ES256, es256Key)
+	if other.EnableKeyRotation(0, 0, stateFile) == nil {
+		t.Error("The keys of other algorithm should be rejected")
+	}
+}
+
+func TestSignatureAlgorithms(t *testing.T) {
+	for _, alg := range []jwa.SignatureAlgorithm{jwa.ES256, jwa.ES384, jwa.PS256, jwa.EdDSA} {
+		key, err := generateSigningKey(alg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = checkSignatureKey(alg, key); err != nil {
+			t.Fatal(err)
+		}
+		server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", alg, key)
+		server.EnableJWKS("/oauth2/jwks")
+		token, err := createTokenWithServer(server)
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+		w := httptest.NewRecorder()
+		server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/oauth2/jwks", nil))
+		keySet, err := jwk.ParseBytes(w.Body.Bytes())
+		if err != nil {
+			t.Fatal(alg, err)
+		}
+		verifier := NewAccessTokenVerifierWithKeySource(alg, NewKeySetSource(keySet))
+		if err = verifier.VerifyToken([]byte(token)); err != nil {
+			t.Error(alg, err)
+		}
+	}
+}
+
+func TestCheckSignatureKey(t *testing.T) {
+	rsaKey, _ := loadSignatureKey([]byte(privateKey))
+	ecKey, _ := generateSigningKey(jwa.ES256)
+	if checkSignatureKey(jwa.RS256, rsaKey) != nil || checkSignatureKey(jwa.PS256, rsaKey) != nil {
+		t.Fail()
+	}
+	if checkSignatureKey(jwa.ES256, rsaKey) == nil || checkSignatureKey(jwa.RS256, ecKey) == nil {
+		t.Fail()
+	}
+	if checkSignatureKey(jwa.ES512, ecKey) == nil || checkSignatureKey(jwa.EdDSA, ecKey) == nil {
+		t.Fail()
+	}
+	if checkSignatureKey(jwa.NoSignature, rsaKey) == nil {
+		t.Fail()
+	}
+}
+
+func TestHMACSignature(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	if checkSignatureKey(jwa.HS256, secret[:16]) == nil || checkSignatureKey(jwa.HS384, secret) == nil {
+		t.Fail()
+	}
+	if err := checkSignatureKey(jwa.HS256, secret); err != nil {
+		t.Fatal(err)
+	}
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.HS256, secret)
+	server.EnableJWKS("/oauth2/jwks")
+	if server.EnableKeyRotation(0, 0, "") == nil {
+		t.Error("HMAC secret should not be rotated")
+	}
+	token, err := createTokenWithServer(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = NewAccessTokenVerifier(jwa.HS256, secret).VerifyToken([]byte(token)); err != nil {
+		t.Error(err)
+	}
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/oauth2/jwks", nil))
+	if w.Body.String() != `{"keys":[]}` {
+		t.Error("The secret must not be published ", w.Body.String())
+	}
+}
@@ -10,6 +10,9 @@ import (
 type ExpiryToken struct {
 	expireTime int64
 	token      string
+	// the scope granted by the authorization server, empty if it is same as
+	// the requested scope
+	scope string
 }
 
 // TokenCache the created token cache.
@@ -29,24 +32,59 @@ func NewTokenCache(minLifeTime int64) *TokenCache {
 
 // CacheToken cache the token with the expireTime
 func (stc *TokenCache) CacheToken(key string, expireTime int64, token string) {
+	stc.CacheGrantedToken(key, expireTime, token, "")
+}
+
+// CacheGrantedToken cache the token with the expireTime and the scope granted
+// by the authorization server
+func (stc *TokenCache) CacheGrantedToken(key string, expireTime int64, token string, scope string) {
 	stc.Lock()
 	defer stc.Unlock()
 
-	stc.tokens[key] = &ExpiryToken{expireTime: expireTime, token: token}
+	stc.tokens[key] = &ExpiryToken{expireTime: expireTime, token: token, scope: scope}
 }
 
 // GetToken get token by key. A valid key will be return if the token of the
 // key exists and the token is not expired within minLifeTime
 func (stc *TokenCache) GetToken(key string) (string, error) {
+	token, _, err := stc.GetTokenWithExpireTime(key)
+	return token, err
+}
+
+// GetTokenWithExpireTime get token and its expire time by key like GetToken
+func (stc *TokenCache) GetTokenWithExpireTime(key string) (string, int64, error) {
+	token, expireTime, _, err := stc.GetGrantedToken(key)
+	return token, expireTime, err
+}
+
+// GetGrantedToken get token, its expire time and its granted scope by key
+// like GetToken
+func (stc *TokenCache) GetGrantedToken(key string) (string, int64, string, error) {
 	stc.Lock()
 	defer stc.Unlock()
 
 	stc.clearExpiredTokens()
 
 	if v, ok := stc.tokens[key]; ok && v.expireTime > time.Now().Unix()+stc.minLifeTime {
-		return v.token, nil
+		return v.token, v.expireTime, v.scope, nil
 	}
-	return "", fmt.Errorf("No token for %s", key)
+	return "", 0, "", fmt.Errorf("No token for %s", key)
+}
+
+// RemoveToken remove the token of the key
+func (stc *TokenCache) RemoveToken(key string) {
+	stc.Lock()
+	defer stc.Unlock()
+
+	delete(stc.tokens, key)
+}
+
+// Clear remove all the tokens
+func (stc *TokenCache) Clear() {
+	stc.Lock()
+	defer stc.Unlock()
+
+	stc.tokens = make(map[string]*ExpiryToken)
 }
 
 func (stc *TokenCache) clearExpiredTokens() {
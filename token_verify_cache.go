@@ -8,41 +8,49 @@ import (
 // TokenVerifyCache caches the verified tokens
 type TokenVerifyCache struct {
 	sync.Mutex
-	tokens map[string]int64
+	tokens map[string]*AccessTokenClaims
 }
 
 // NewTokenVerifyCache create a TokenVerifyCache object
 func NewTokenVerifyCache() *TokenVerifyCache {
-	return &TokenVerifyCache{tokens: make(map[string]int64)}
+	return &TokenVerifyCache{tokens: make(map[string]*AccessTokenClaims)}
 }
 
-// AddVerifiedToken add a verified token with its expire time to the cache
+// AddVerifiedToken add a verified token with its claims to the cache
 //
-// if the expireTime is less than current time, the token will not be added
+// if the expire time in claims is less than current time, the token will not be added
 // to the cache
-func (tvc *TokenVerifyCache) AddVerifiedToken(token string, expireTime int64) {
-	if expireTime <= time.Now().Unix() {
+func (tvc *TokenVerifyCache) AddVerifiedToken(token string, claims *AccessTokenClaims) {
+	if claims.Exp <= time.Now().Unix() {
 		return
 	}
 
 	tvc.Lock()
 	defer tvc.Unlock()
 
-	tvc.tokens[token] = expireTime
+	tvc.tokens[token] = claims
 }
 
-// IsTokenVerified check if the token is verified and it is not expired
+// GetVerifiedToken get the claims of the verified token if it is not expired
 //
-// return true if the token is verifed and not expired
-func (tvc *TokenVerifyCache) IsTokenVerified(token string) bool {
+// return false if the token is not verifed or it is expired
+func (tvc *TokenVerifyCache) GetVerifiedToken(token string) (*AccessTokenClaims, bool) {
 	tvc.Lock()
 	defer tvc.Unlock()
 
 	if v, ok := tvc.tokens[token]; ok {
-		if v > time.Now().Unix() {
-			return true
+		if v.Exp > time.Now().Unix() {
+			return v, true
 		}
 		delete(tvc.tokens, token)
 	}
-	return false
+	return nil, false
+}
+
+// IsTokenVerified check if the token is verified and it is not expired
+//
+// return true if the token is verifed and not expired
+func (tvc *TokenVerifyCache) IsTokenVerified(token string) bool {
+	_, ok := tvc.GetVerifiedToken(token)
+	return ok
 }
@@ -7,26 +7,58 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"github.com/lestrrat-go/jwx/jwk"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"gopkg.in/yaml.v3"
 	"io/ioutil"
-	"strings"
+	"net/http"
 )
 
+// loadSignatureKeyFromFile load the key from a PEM file, a JWK file or a JWK
+// set file with only one key
 func loadSignatureKeyFromFile(fileName string) (interface{}, error) {
-	if strings.HasSuffix(fileName, ".pem") {
-		b, err := ioutil.ReadFile(fileName)
-		if err != nil {
-			return nil, err
-		}
-		return loadSignatureKey(b)
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")) {
+		return loadJWKSignatureKey(b)
 	}
-	return nil, fmt.Errorf("only .pem file supported")
+	return loadSignatureKey(b)
 }
+
+// loadJWKSignatureKey load the key from a JWK or a JWK set with only one key
+func loadJWKSignatureKey(b []byte) (interface{}, error) {
+	keySet, err := jwk.ParseBytes(b)
+	if err != nil {
+		return nil, err
+	}
+	if len(keySet.Keys) != 1 {
+		return nil, fmt.Errorf("Only one key is allowed but %d keys are found in JWK set", len(keySet.Keys))
+	}
+	var key interface{}
+	if err = keySet.Keys[0].Raw(&key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
 func loadSignatureKey(b []byte) (interface{}, error) {
 	p, _ := pem.Decode(b)
 	if p == nil {
 		return nil, fmt.Errorf("not in PEM format")
 	}
+	switch p.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(p.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(p.Bytes)
+	}
 	k1, err := x509.ParsePKCS1PrivateKey(p.Bytes)
 	if err == nil {
 		return k1, nil
@@ -86,3 +118,40 @@ func loadCertFile(caCertFile string, certFile string, keyFile string) (*tls.Conf
 	}
 	return &tls.Config{RootCAs: rootCAs}, nil
 }
+
+// listenAndServe serve the requests in the address with HTTP/1.1, or also with
+// HTTP/2 with prior knowledge(h2c) if http2 is true. The TLS is enabled if the
+// certificate and key files are set, and the client certificate signed by the
+// CA in clientCAFile is required if it is set
+func listenAndServe(addr string, handler http.Handler, http2Enabled bool, tlsCertFile string, tlsKeyFile string, clientCAFile string) error {
+	if http2Enabled {
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
+	server := &http.Server{Addr: addr, Handler: handler}
+	if len(tlsCertFile) > 0 && len(tlsKeyFile) > 0 {
+		if len(clientCAFile) > 0 {
+			clientCAs, err := loadClientCAs(clientCAFile)
+			if err != nil {
+				return err
+			}
+			server.TLSConfig = &tls.Config{ClientCAs: clientCAs, ClientAuth: tls.RequireAndVerifyClientCert}
+		}
+		return server.ListenAndServeTLS(tlsCertFile, tlsKeyFile)
+	} else if len(clientCAFile) > 0 {
+		return fmt.Errorf("mTLS can't be enabled without tlsCertFile and tlsKeyFile")
+	}
+	return server.ListenAndServe()
+}
+
+// loadClientCAs load the CA certificates to verify the client certificate
+func loadClientCAs(clientCAFile string) (*x509.CertPool, error) {
+	b, err := ioutil.ReadFile(clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("No CA certificate in %s", clientCAFile)
+	}
+	return clientCAs, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/lestrrat-go/jwx/jwa"
+	"github.com/lestrrat-go/jwx/jwk"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadECPrivateKey(t *testing.T) {
+	key, _ := generateSigningKey(jwa.ES384)
+	b, err := x509.MarshalECPrivateKey(key.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadSignatureKey(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkSignatureKey(jwa.ES384, loaded) != nil || checkSignatureKey(jwa.ES256, loaded) == nil {
+		t.Fail()
+	}
+}
+
+func TestLoadEd25519Key(t *testing.T) {
+	key, _ := generateSigningKey(jwa.EdDSA)
+	b, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadSignatureKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: b}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loaded.(ed25519.PrivateKey); !ok {
+		t.Fatalf("Unexpected key type %T", loaded)
+	}
+	b, _ = x509.MarshalPKIXPublicKey(key.(ed25519.PrivateKey).Public())
+	loaded, err = loadSignatureKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: b}))
+	if err != nil || checkSignatureKey(jwa.EdDSA, loaded) != nil {
+		t.Fail()
+	}
+}
+
+func TestLoadJWKSignatureKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jwk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, _ := generateSigningKey(jwa.ES256)
+	k, _ := jwk.New(key)
+	b, _ := json.Marshal(k)
+	fileName := filepath.Join(dir, "key.json")
+	ioutil.WriteFile(fileName, b, 0600)
+	loaded, err := loadSignatureKeyFromFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loaded.(*ecdsa.PrivateKey); !ok {
+		t.Fatalf("Unexpected key type %T", loaded)
+	}
+
+	keySet := &jwk.Set{Keys: []jwk.Key{k}}
+	b, _ = json.Marshal(keySet)
+	fileName = filepath.Join(dir, "key.jwks")
+	ioutil.WriteFile(fileName, b, 0600)
+	if _, err = loadSignatureKeyFromFile(fileName); err != nil {
+		t.Error(err)
+	}
+
+	keySet.Keys = append(keySet.Keys, k)
+	b, _ = json.Marshal(keySet)
+	ioutil.WriteFile(fileName, b, 0600)
+	if _, err = loadSignatureKeyFromFile(fileName); err == nil {
+		t.Error("JWK set with two keys should be rejected")
+	}
+}
+
+func TestListenAndServeMutualTLSWithoutTLS(t *testing.T) {
+	if listenAndServe("127.0.0.1:0", nil, false, "", "", "cert/public.crt") == nil {
+		t.Error("mTLS should not be enabled without TLS")
+	}
+}
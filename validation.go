@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+)
+
+// the patterns of the data types defined in TS 29.571
+var (
+	uuidPattern = regexp.MustCompile("^[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}$")
+	mccPattern  = regexp.MustCompile("^[0-9]{3}$")
+	mncPattern  = regexp.MustCompile("^[0-9]{2,3}$")
+	sdPattern   = regexp.MustCompile("^[A-Fa-f0-9]{6}$")
+	nidPattern  = regexp.MustCompile("^[A-Fa-f0-9]{11}$")
+	fqdnPattern = regexp.MustCompile(`^([0-9A-Za-z]([-0-9A-Za-z]{0,61}[0-9A-Za-z])?\.)+[A-Za-z]{2,63}\.?$`)
+)
+
+// NewInvalidRequestError create a invalid_request AccessTokenError with the
+// error_description tells the invalid field
+func NewInvalidRequestError(format string, args ...interface{}) *AccessTokenError {
+	return &AccessTokenError{Error: InvalidRequest, ErrorDescription: fmt.Sprintf(format, args...)}
+}
+
+// IsValidUUID return true if the s is a UUID defined in RFC 4122, for
+// example the NF instance id
+func IsValidUUID(s string) bool {
+	return uuidPattern.MatchString(s)
+}
+
+// IsValidFqdn return true if the s is a FQDN with 4 to 253 characters
+func IsValidFqdn(s string) bool {
+	return len(s) >= 4 && len(s) <= 253 && fqdnPattern.MatchString(s)
+}
+
+// Validate check the mcc is 3 digits and the mnc is 2 or 3 digits. The
+// field is the name of the PlmnID in the error_description
+func (p *PlmnID) Validate(field string) *AccessTokenError {
+	if !mccPattern.MatchString(p.Mcc) {
+		return NewInvalidRequestError("invalid %s.mcc %s", field, p.Mcc)
+	}
+	if !mncPattern.MatchString(p.Mnc) {
+		return NewInvalidRequestError("invalid %s.mnc %s", field, p.Mnc)
+	}
+	return nil
+}
+
+// Validate check the PLMN ID and the nid is 11 hexadecimal digits
+func (p *PlmnIDNid) Validate(field string) *AccessTokenError {
+	if accessTokenErr := (&PlmnID{Mcc: p.Mcc, Mnc: p.Mnc}).Validate(field); accessTokenErr != nil {
+		return accessTokenErr
+	}
+	if !IsValidNid(p.Nid) {
+		return NewInvalidRequestError("invalid %s.nid %s", field, p.Nid)
+	}
+	return nil
+}
+
+// Validate check the sst is in [0,255] and the sd is 6 hexadecimal digits
+// if it is present
+func (s *Snssai) Validate(field string) *AccessTokenError {
+	if s.Sst < 0 || s.Sst > 255 {
+		return NewInvalidRequestError("invalid %s.sst %d", field, s.Sst)
+	}
+	if len(s.Sd) > 0 && !sdPattern.MatchString(s.Sd) {
+		return NewInvalidRequestError("invalid %s.sd %s", field, s.Sd)
+	}
+	return nil
+}
+
+// Validate check the format of the fields of the AccessTokenRequest. Return
+// the invalid_request error with the error_description naming the invalid field
+func (atr *AccessTokenRequest) Validate() *AccessTokenError {
+	if len(atr.NfInstanceID) > 0 && !IsValidUUID(atr.NfInstanceID) {
+		return NewInvalidRequestError("invalid nfInstanceId %s", atr.NfInstanceID)
+	}
+	if len(atr.NfType) > 0 && !IsValidNFType(atr.NfType) {
+		return NewInvalidRequestError("invalid nfType %s", atr.NfType)
+	}
+	if len(atr.TargetNfType) > 0 && !IsValidNFType(atr.TargetNfType) {
+		return NewInvalidRequestError("invalid targetNfType %s", atr.TargetNfType)
+	}
+	if len(atr.TargetNfInstanceID) > 0 && !IsValidUUID(atr.TargetNfInstanceID) {
+		return NewInvalidRequestError("invalid targetNfInstanceId %s", atr.TargetNfInstanceID)
+	}
+	if atr.RequesterPlmn != nil {
+		if accessTokenErr := atr.RequesterPlmn.Validate("requesterPlmn"); accessTokenErr != nil {
+			return accessTokenErr
+		}
+	}
+	for i, plmn := range atr.RequesterPlmnList {
+		if accessTokenErr := plmn.Validate(fmt.Sprintf("requesterPlmnList[%d]", i)); accessTokenErr != nil {
+			return accessTokenErr
+		}
+	}
+	for i, snssai := range atr.RequesterSnssaiList {
+		if accessTokenErr := snssai.Validate(fmt.Sprintf("requesterSnssaiList[%d]", i)); accessTokenErr != nil {
+			return accessTokenErr
+		}
+	}
+	if len(atr.RequesterFqdn) > 0 && !IsValidFqdn(atr.RequesterFqdn) {
+		return NewInvalidRequestError("invalid requesterFqdn %s", atr.RequesterFqdn)
+	}
+	for i, snpn := range atr.RequesterSnpnList {
+		if accessTokenErr := snpn.Validate(fmt.Sprintf("requesterSnpnList[%d]", i)); accessTokenErr != nil {
+			return accessTokenErr
+		}
+	}
+	if atr.TargetPlmn != nil {
+		if accessTokenErr := atr.TargetPlmn.Validate("targetPlmn"); accessTokenErr != nil {
+			return accessTokenErr
+		}
+	}
+	if atr.TargetSnpn != nil {
+		if accessTokenErr := atr.TargetSnpn.Validate("targetSnpn"); accessTokenErr != nil {
+			return accessTokenErr
+		}
+	}
+	for i, snssai := range atr.TargetSnssaiList {
+		if accessTokenErr := snssai.Validate(fmt.Sprintf("targetSnssaiList[%d]", i)); accessTokenErr != nil {
+			return accessTokenErr
+		}
+	}
+	if len(atr.HnrfAccessTokenURI) > 0 {
+		if u, err := url.Parse(atr.HnrfAccessTokenURI); err != nil || !u.IsAbs() || len(u.Host) <= 0 {
+			return NewInvalidRequestError("invalid hnrfAccessTokenUri %s", atr.HnrfAccessTokenURI)
+		}
+	}
+	if len(atr.SourceNfInstanceID) > 0 && !IsValidUUID(atr.SourceNfInstanceID) {
+		return NewInvalidRequestError("invalid sourceNfInstanceId %s", atr.SourceNfInstanceID)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"github.com/lestrrat-go/jwx/jwa"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func createValidRequest() *AccessTokenRequest {
+	req := NewAccessTokenRequest()
+	req.GrantType = "client_credentials"
+	req.NfInstanceID = "5a7bd676-ceeb-44bb-95e0-f6a55a312345"
+	req.NfType = "AMF"
+	req.TargetNfType = "UDM"
+	req.Scope = "nudm-sdm"
+	req.RequesterPlmnList = []*PlmnID{&PlmnID{Mcc: "460", Mnc: "001"}}
+	req.RequesterSnssaiList = []*Snssai{&Snssai{Sst: 255, Sd: "0000aF"}}
+	req.RequesterFqdn = "amf1.cluster1.net2.amf.5gc.mnc012.mcc345.3gppnetwork.org"
+	req.TargetPlmn = &PlmnID{Mcc: "460", Mnc: "00"}
+	req.TargetSnssaiList = []*Snssai{&Snssai{Sst: 0}}
+	return req
+}
+
+func TestValidateAccessTokenRequest(t *testing.T) {
+	if accessTokenErr := createValidRequest().CheckValid(); accessTokenErr != nil {
+		t.Fatal(accessTokenErr.ErrorDescription)
+	}
+	for field, update := range map[string]func(req *AccessTokenRequest){
+		"nfInstanceId":           func(req *AccessTokenRequest) { req.NfInstanceID = "amf-1" },
+		"targetNfInstanceId":     func(req *AccessTokenRequest) { req.TargetNfInstanceID = "5a7bd676-ceeb-44bb-95e0-f6a55a31234" },
+		"nfType":                 func(req *AccessTokenRequest) { req.NfType = "amf" },
+		"requesterPlmn":          func(req *AccessTokenRequest) { req.RequesterPlmn = &PlmnID{Mcc: "46", Mnc: "00"} },
+		"requesterPlmnList[0]":   func(req *AccessTokenRequest) { req.RequesterPlmnList[0].Mnc = "0001" },
+		"requesterSnssaiList[0]": func(req *AccessTokenRequest) { req.RequesterSnssaiList[0].Sd = "00000g" },
+		"requesterFqdn":          func(req *AccessTokenRequest) { req.RequesterFqdn = "-amf.example.com" },
+		"requesterSnpnList[0]": func(req *AccessTokenRequest) {
+			req.RequesterSnpnList = []*PlmnIDNid{&PlmnIDNid{Mcc: "460", Mnc: "00", Nid: "000007ed9d"}}
+		},
+		"targetPlmn":          func(req *AccessTokenRequest) { req.TargetPlmn.Mcc = "4a0" },
+		"targetSnpn":          func(req *AccessTokenRequest) { req.TargetSnpn = &PlmnIDNid{Mcc: "460", Mnc: "0", Nid: "000007ed9d5"} },
+		"targetSnssaiList[0]": func(req *AccessTokenRequest) { req.TargetSnssaiList[0].Sst = 256 },
+	} {
+		req := createValidRequest()
+		update(req)
+		accessTokenErr := req.CheckValid()
+		if accessTokenErr == nil || accessTokenErr.Error != InvalidRequest || !strings.HasPrefix(accessTokenErr.ErrorDescription, "invalid "+field) {
+			t.Errorf("The invalid %s should be rejected but get %v", field, accessTokenErr)
+		}
+	}
+}
+
+func TestIsValidFqdn(t *testing.T) {
+	for fqdn, valid := range map[string]bool{"amf.example.com": true,
+		"amf.example.com.":                      true,
+		"a-1.b":                                 false,
+		"amf":                                   false,
+		"amf..example.com":                      false,
+		"amf-.example.com":                      false,
+		"amf.example.c0m":                       false,
+		strings.Repeat("a", 64) + ".com":        false,
+		strings.Repeat("a.", 125) + "com":       true,
+		strings.Repeat("a.", 126) + "com":       false,
+		"nrf.5gc.mnc012.mcc345.3gppnetwork.org": true} {
+		if IsValidFqdn(fqdn) != valid {
+			t.Errorf("Expect %v for FQDN %s", valid, fqdn)
+		}
+	}
+}
+
+func TestProxyRejectInvalidRequest(t *testing.T) {
+	pubKey, _ := loadSignatureKey([]byte(publicKey))
+	proxy := NewProxy("/reqtoken", "/verify", "http://127.0.0.1:1", nil, false, jwa.RS256, NewStaticKeySource(pubKey))
+	for contentType, body := range map[string]string{
+		"application/json": `{"grant_type":"client_credentials","nfInstanceId":"5a7bd676-ceeb-44bb-95e0-f6a55a312345","nfType":"AMF","targetNfType":"UDM","scope":"nudm-sdm","targetSnssaiList":[{"sst":256}]}`,
+		"application/x-www-form-urlencoded": "grant_type=client_credentials&nfInstanceId=5a7bd676-ceeb-44bb-95e0-f6a55a312345&nfType=AMF&targetNfType=UDM&scope=nudm-sdm" +
+			"&targetSnssaiList=%5B%7B%22sst%22%3A256%7D%5D"} {
+		req := httptest.NewRequest(http.MethodPost, "/reqtoken", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		proxy.router.ServeHTTP(w, req)
+		accessTokenErr := &AccessTokenError{}
+		if w.Code != http.StatusBadRequest || accessTokenErr.FromJSON(w.Body.Bytes()) != nil ||
+			accessTokenErr.ErrorDescription != "invalid targetSnssaiList[0].sst 256" {
+			t.Errorf("The invalid %s request should be rejected but get %d %s", contentType, w.Code, w.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/reqtoken", bytes.NewBufferString("{"))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	proxy.router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), InvalidRequest) {
+		t.Error("The malformed request should be rejected with invalid_request")
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// VerificationOptions the expected claims of the token received by the NF
+// service producer. The empty option is not checked
+type VerificationOptions struct {
+	// the accepted issuers, the NF instance ids of the NRFs
+	Issuers []string `yaml:"issuers,omitempty"`
+	// the aud must contain the NF instance id or the NF type of the producer
+	NfInstanceID string `yaml:"nfInstanceId,omitempty"`
+	NfType       string `yaml:"nfType,omitempty"`
+	// the space-delimited scope required by the operation
+	Scope string `yaml:"scope,omitempty"`
+	// the PLMN of the producer, must match the producerPlmnID if it is present
+	PlmnID *PlmnID `yaml:"plmnId,omitempty"`
+	// the served S-NSSAIs, one of them must be in the producerSnssaiList if it is present
+	SnssaiList []*Snssai `yaml:"snssaiList,omitempty"`
+	// the served NSIs, one of them must be in the producerNsiList if it is present
+	NsiList []string `yaml:"nsiList,omitempty"`
+	// the NF set of the producer, must match the producerNfSetId if it is present
+	NfSetID string `yaml:"nfSetId,omitempty"`
+	// the PLMN ID and NID of the producer in a SNPN, must match the
+	// producerSnpnId. The token without producerSnpnId is rejected
+	Snpn *PlmnIDNid `yaml:"snpn,omitempty"`
+}
+
+// ClaimError the error tells which claim of the token fails the check
+type ClaimError struct {
+	// the name of the claim, for example "aud" or "producerPlmnID"
+	Claim  string
+	Reason string
+}
+
+// NewClaimError create a ClaimError of the claim
+func NewClaimError(claim string, format string, args ...interface{}) *ClaimError {
+	return &ClaimError{Claim: claim, Reason: fmt.Sprintf(format, args...)}
+}
+
+func (e *ClaimError) Error() string {
+	return fmt.Sprintf("Invalid claim %s: %s", e.Claim, e.Reason)
+}
+
+// WithScope create a copy of the options with the scope required by the operation
+func (vo *VerificationOptions) WithScope(scope string) *VerificationOptions {
+	options := &VerificationOptions{}
+	if vo != nil {
+		*options = *vo
+	}
+	options.Scope = scope
+	return options
+}
+
+// Validate check the claims against the options, a *ClaimError is returned
+// if a check fails. No check if the options is nil
+func (vo *VerificationOptions) Validate(atc *AccessTokenClaims) error {
+	if vo == nil {
+		return nil
+	}
+	if len(vo.Issuers) > 0 && !containsString(vo.Issuers, atc.Iss) {
+		return NewClaimError("iss", "the issuer %s is not accepted", atc.Iss)
+	}
+	if err := vo.validateAudience(atc); err != nil {
+		return err
+	}
+	if len(vo.Scope) > 0 && !atc.HasScope(vo.Scope) {
+		return NewClaimError("scope", "the scope %s is not granted by %s", vo.Scope, atc.Scope)
+	}
+	if vo.PlmnID != nil && atc.ProducerPlmnID != nil && !vo.PlmnID.Equal(atc.ProducerPlmnID) {
+		return NewClaimError("producerPlmnID", "the PLMN %s is not %s", atc.ProducerPlmnID.String(), vo.PlmnID.String())
+	}
+	if len(vo.SnssaiList) > 0 && len(atc.ProducerSnssaiList) > 0 && !containsAnySnssai(atc.ProducerSnssaiList, vo.SnssaiList) {
+		return NewClaimError("producerSnssaiList", "no served S-NSSAI is in the list")
+	}
+	if len(vo.NsiList) > 0 && len(atc.ProducerNsiList) > 0 && !containsAnyString(atc.ProducerNsiList, vo.NsiList) {
+		return NewClaimError("producerNsiList", "no served NSI is in %s", strings.Join(atc.ProducerNsiList, ","))
+	}
+	if len(vo.NfSetID) > 0 && len(atc.ProducerNfSetID) > 0 && vo.NfSetID != atc.ProducerNfSetID {
+		return NewClaimError("producerNfSetId", "the NF set %s is not %s", atc.ProducerNfSetID, vo.NfSetID)
+	}
+	if vo.Snpn != nil && !vo.Snpn.Equal(atc.ProducerSnpnID) {
+		if atc.ProducerSnpnID == nil {
+			return NewClaimError("producerSnpnId", "the token is not for the SNPN %s", vo.Snpn)
+		}
+		return NewClaimError("producerSnpnId", "the SNPN %s is not %s", atc.ProducerSnpnID, vo.Snpn)
+	}
+	return nil
+}
+
+// validateAudience check if the aud contains the NF instance id or the NF
+// type of the producer
+func (vo *VerificationOptions) validateAudience(atc *AccessTokenClaims) error {
+	if len(vo.NfInstanceID) <= 0 && len(vo.NfType) <= 0 {
+		return nil
+	}
+	for _, aud := range atc.Aud {
+		if (len(vo.NfInstanceID) > 0 && aud == vo.NfInstanceID) || (len(vo.NfType) > 0 && aud == vo.NfType) {
+			return nil
+		}
+	}
+	return NewClaimError("aud", "the audience %s does not contain %s", strings.Join(atc.Aud, ","), strings.Trim(vo.NfInstanceID+","+vo.NfType, ","))
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAnyString(values []string, others []string) bool {
+	for _, other := range others {
+		if containsString(values, other) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAnySnssai(snssais []*Snssai, others []*Snssai) bool {
+	for _, other := range others {
+		if containsSnssai(snssais, other) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"github.com/lestrrat-go/jwx/jwa"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func expectClaimError(t *testing.T, err error, claim string) {
+	var claimErr *ClaimError
+	if !errors.As(err, &claimErr) || claimErr.Claim != claim {
+		t.Errorf("Expect the check of %s fails but the error is %v", claim, err)
+	}
+}
+
+func TestVerifyTokenWithOptions(t *testing.T) {
+	key, _ := loadSignatureKey([]byte(privateKey))
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	token, _ := createTokenWithServer(server)
+	pubKey, _ := loadSignatureKey([]byte(publicKey))
+	verifier := NewAccessTokenVerifier(jwa.RS256, pubKey)
+
+	options := &VerificationOptions{Issuers: []string{"instance-2", "instance-1"},
+		NfType:     "AMF",
+		Scope:      "namf-comm",
+		PlmnID:     &PlmnID{Mcc: "460", Mnc: "00"},
+		SnssaiList: []*Snssai{&Snssai{Sst: 30, Sd: "000002"}},
+		NsiList:    []string{"nsi-2"}}
+	if _, err := verifier.VerifyTokenWithOptions([]byte(token), options); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := verifier.VerifyTokenWithOptions([]byte(token), &VerificationOptions{Issuers: []string{"instance-2"}})
+	expectClaimError(t, err, "iss")
+	_, err = verifier.VerifyTokenWithOptions([]byte(token), &VerificationOptions{NfType: "SMF", NfInstanceID: "8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001"})
+	expectClaimError(t, err, "aud")
+	_, err = verifier.VerifyTokenWithOptions([]byte(token), options.WithScope("namf-loc"))
+	expectClaimError(t, err, "scope")
+	_, err = verifier.VerifyTokenWithOptions([]byte(token), &VerificationOptions{SnssaiList: []*Snssai{&Snssai{Sst: 30}}})
+	expectClaimError(t, err, "producerSnssaiList")
+	_, err = verifier.VerifyTokenWithOptions([]byte(token), &VerificationOptions{NsiList: []string{"nsi-4"}})
+	expectClaimError(t, err, "producerNsiList")
+
+	// the options set in verifier is checked even if the token is in the verified cache
+	verifier.SetVerificationOptions(&VerificationOptions{NfType: "SMF"})
+	_, err = verifier.VerifyTokenClaims([]byte(token))
+	expectClaimError(t, err, "aud")
+}
+
+func TestValidateProducerClaims(t *testing.T) {
+	claims := &AccessTokenClaims{Aud: []string{"8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001"},
+		ProducerPlmnID:  &PlmnID{Mcc: "460", Mnc: "01"},
+		ProducerNfSetID: "set1.amfset.5gc.mnc001.mcc460"}
+	if err := (&VerificationOptions{NfInstanceID: "8f0e1c2d-3b4a-4e5f-9a6b-7c8d9e0fa001", NfType: "AMF"}).Validate(claims); err != nil {
+		t.Error(err)
+	}
+	expectClaimError(t, (&VerificationOptions{PlmnID: &PlmnID{Mcc: "460", Mnc: "00"}}).Validate(claims), "producerPlmnID")
+	expectClaimError(t, (&VerificationOptions{NfSetID: "set2.amfset.5gc.mnc001.mcc460"}).Validate(claims), "producerNfSetId")
+	snpn := &PlmnIDNid{Mcc: "460", Mnc: "01", Nid: "000007ed9d5"}
+	expectClaimError(t, (&VerificationOptions{Snpn: snpn}).Validate(claims), "producerSnpnId")
+	claims.ProducerSnpnID = &PlmnIDNid{Mcc: "460", Mnc: "01", Nid: "000007ED9D5"}
+	if err := (&VerificationOptions{Snpn: snpn}).Validate(claims); err != nil {
+		t.Error(err)
+	}
+	claims.ProducerSnpnID.Nid = "000007ed9d6"
+	expectClaimError(t, (&VerificationOptions{Snpn: snpn}).Validate(claims), "producerSnpnId")
+	var options *VerificationOptions
+	if options.Validate(claims) != nil {
+		t.Error("No claim should be checked without options")
+	}
+}
+
+func TestProxyVerifyTokenScope(t *testing.T) {
+	key, _ := loadSignatureKey([]byte(privateKey))
+	server := NewOAuthServer("", "instance-1", time.Duration(3600)*time.Second, false, "", "", jwa.RS256, key)
+	token, _ := createTokenWithServer(server)
+	pubKey, _ := loadSignatureKey([]byte(publicKey))
+	proxy := NewProxy("/reqtoken", "/verify", "http://127.0.0.1:1", nil, false, jwa.RS256, NewStaticKeySource(pubKey))
+	proxy.SetVerificationOptions(&VerificationOptions{NfType: "AMF"})
+
+	for scope, code := range map[string]int{"namf-comm": http.StatusOK, "namf-loc": http.StatusBadRequest} {
+		req := httptest.NewRequest(http.MethodPost, "/verify?scope="+scope, strings.NewReader(token))
+		w := httptest.NewRecorder()
+		proxy.router.ServeHTTP(w, req)
+		if w.Code != code {
+			t.Errorf("Expect status %d for scope %s but get %d", code, scope, w.Code)
+		}
+	}
+}